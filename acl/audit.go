@@ -0,0 +1,92 @@
+package acl
+
+import (
+	"database/sql"
+	"time"
+)
+
+/*
+	Audit log.
+
+	Every change to ACLs and groups is recorded, along with who made it
+	and where, so that we can tell later how someone got access to a command.
+*/
+
+// Actions recorded in the audit log.
+const (
+	ActionAdd         = "add"
+	ActionDeny        = "deny"
+	ActionRemove      = "remove"
+	ActionExpire      = "expire"
+	ActionGroupAdd    = "group_add"
+	ActionGroupRemove = "group_remove"
+	ActionDisable     = "disable"
+	ActionEnable      = "enable"
+)
+
+// AuditEntry is a change recorded in the audit log.
+type AuditEntry struct {
+	Time time.Time
+	// Who made the change, empty for changes made by the bot itself.
+	Actor  string
+	Action string
+	// The command the ACL refers to, or the group for group changes.
+	Command string
+	// The user, channel or group, or the channel the command
+	// was disabled or enabled in.
+	Identifier string
+	// The channel the change was made in, empty if in private.
+	Channel string
+}
+
+// execer is either a database or a transaction.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Audit records a change in the audit log.
+func Audit(entry AuditEntry, db *sql.DB) error {
+	return audit(entry, db)
+}
+
+func audit(entry AuditEntry, db execer) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	_, err := db.Exec(
+		"INSERT INTO acl_audit (timestamp, actor, action, command, identifier, channel) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.Time.Unix(), entry.Actor, entry.Action, entry.Command, entry.Identifier, entry.Channel,
+	)
+	return err
+}
+
+// AuditLog returns at most limit changes about a command, or about any command
+// if it's empty, newest first and skipping the first offset ones.
+// It also returns how many changes were recorded in total.
+func AuditLog(command string, offset int, limit int, db *sql.DB) ([]AuditEntry, int, error) {
+	entries := make([]AuditEntry, 0)
+	where := "WHERE ? = '' OR command = ?"
+	var total int
+	err := db.QueryRow("SELECT count(1) FROM acl_audit "+where, command, command).Scan(&total)
+	if err != nil {
+		return entries, 0, err
+	}
+	rows, err := db.Query(
+		"SELECT timestamp, actor, action, command, identifier, channel FROM acl_audit "+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		command, command, limit, offset,
+	)
+	if err != nil {
+		return entries, total, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEntry
+		var timestamp int64
+		if err := rows.Scan(&timestamp, &e.Actor, &e.Action, &e.Command, &e.Identifier, &e.Channel); err != nil {
+			return entries, total, err
+		}
+		e.Time = time.Unix(timestamp, 0)
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
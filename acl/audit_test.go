@@ -0,0 +1,54 @@
+package acl
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	db := getDb(t)
+	start := time.Now().Truncate(time.Second)
+	for i := 0; i < 12; i++ {
+		entry := AuditEntry{
+			Time:       start.Add(time.Duration(i) * time.Minute),
+			Actor:      "admin",
+			Action:     ActionAdd,
+			Command:    "contact_get",
+			Identifier: fmt.Sprintf("user%d", i),
+			Channel:    "#sre",
+		}
+		if err := Audit(entry, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Audit(AuditEntry{Actor: "admin", Action: ActionGroupAdd, Command: "@sre", Identifier: "jane"}, db); err != nil {
+		t.Fatal(err)
+	}
+	// The newest changes come first.
+	entries, total, err := AuditLog("contact_get", 0, 10, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 12 || len(entries) != 10 {
+		t.Fatalf("Expected 10 changes out of 12, got %d out of %d", len(entries), total)
+	}
+	if entries[0].Identifier != "user11" || !entries[0].Time.Equal(start.Add(11*time.Minute)) || entries[0].Channel != "#sre" {
+		t.Errorf("Unexpected first change: %v", entries[0])
+	}
+	entries, _, err = AuditLog("contact_get", 10, 10, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Identifier != "user0" {
+		t.Errorf("Unexpected second page: %v", entries)
+	}
+	// Without a command, all changes are returned.
+	entries, total, err = AuditLog("", 0, 1, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 13 || entries[0].Command != "@sre" || entries[0].Action != ActionGroupAdd {
+		t.Errorf("Unexpected changes: %v (%d in total)", entries, total)
+	}
+}
@@ -0,0 +1,139 @@
+package acl
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/lavagetto/ircbot/bot"
+)
+
+/*
+	ACL cache.
+
+	ACLs are checked on every command, so we keep them in memory instead of
+	querying the database every time. The cache is invalidated whenever ACLs
+	or groups are changed through this package; changes made to the database
+	by other means are only seen after a restart.
+	Time-limited entries are taken into account: an ACL is reloaded once the
+	first of its entries expires.
+	The commands disabled in channels are checked on every command too, and
+	are cached the same way.
+*/
+
+type cacheKey struct {
+	db   *sql.DB
+	conf *bot.Configuration
+}
+
+type cachedACL struct {
+	acl *commandACL
+	// When the first time-limited entry of the ACL expires.
+	validUntil time.Time
+}
+
+// A command disabled in a channel.
+type switchKey struct {
+	channel string
+	command string
+}
+
+var cache = struct {
+	sync.RWMutex
+	acls map[cacheKey]map[string]cachedACL
+	// The commands disabled in channels, by database.
+	switches map[*sql.DB]map[switchKey]bool
+	// Incremented at every invalidation, so that we don't store
+	// ACLs that were read before a change.
+	generation uint64
+}{
+	acls:     make(map[cacheKey]map[string]cachedACL),
+	switches: make(map[*sql.DB]map[switchKey]bool),
+}
+
+// cached returns an ACL from the cache, if it's there. Otherwise it returns
+// the generation of the cache to pass to store once the ACL is loaded.
+func cached(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, uint64, bool) {
+	cache.RLock()
+	defer cache.RUnlock()
+	entry, ok := cache.acls[cacheKey{db, conf}][ID]
+	if !ok || (!entry.validUntil.IsZero() && !time.Now().Before(entry.validUntil)) {
+		return nil, cache.generation, false
+	}
+	return entry.acl, cache.generation, true
+}
+
+func store(ID string, db *sql.DB, conf *bot.Configuration, c *commandACL, generation uint64) {
+	entry := cachedACL{acl: c}
+	for _, expires := range c.expires {
+		if entry.validUntil.IsZero() || expires.Before(entry.validUntil) {
+			entry.validUntil = expires
+		}
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	if generation != cache.generation {
+		return
+	}
+	key := cacheKey{db, conf}
+	if cache.acls[key] == nil {
+		cache.acls[key] = make(map[string]cachedACL)
+	}
+	cache.acls[key][ID] = entry
+}
+
+// invalidate empties the cache of all the ACLs stored in a database.
+func invalidate(db *sql.DB) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.generation++
+	for key := range cache.acls {
+		if key.db == db {
+			delete(cache.acls, key)
+		}
+	}
+	delete(cache.switches, db)
+}
+
+// cachedSwitches returns the commands disabled in channels from the cache,
+// if they're there. Otherwise it returns the generation of the cache to pass
+// to storeSwitches once they're loaded.
+func cachedSwitches(db *sql.DB) (map[switchKey]bool, uint64, bool) {
+	cache.RLock()
+	defer cache.RUnlock()
+	switches, ok := cache.switches[db]
+	return switches, cache.generation, ok
+}
+
+func storeSwitches(db *sql.DB, switches map[switchKey]bool, generation uint64) {
+	cache.Lock()
+	defer cache.Unlock()
+	if generation != cache.generation {
+		return
+	}
+	cache.switches[db] = switches
+}
+
+// LoadCache loads all the ACLs stored in the database in the cache.
+func LoadCache(db *sql.DB, conf *bot.Configuration) error {
+	rows, err := db.Query("SELECT DISTINCT command FROM acls")
+	if err != nil {
+		return err
+	}
+	commands := make([]string, 0)
+	for rows.Next() {
+		var command string
+		if err := rows.Scan(&command); err != nil {
+			rows.Close()
+			return err
+		}
+		commands = append(commands, command)
+	}
+	rows.Close()
+	for _, command := range commands {
+		if _, err := GetACL(command, db, conf); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
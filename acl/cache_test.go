@@ -0,0 +1,86 @@
+package acl
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	db := getDb(t)
+	conf := getConfig()
+	if err := SaveACL("test", "alice", db); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadCache(db, conf); err != nil {
+		t.Fatal(err)
+	}
+	c, _, ok := cached("test", db, conf)
+	if !ok {
+		t.Fatal("The ACL should have been loaded in the cache")
+	}
+	if other, _ := GetACL("test", db, conf); other != c {
+		t.Error("The ACL should have been returned from the cache")
+	}
+	// Changes invalidate the cache.
+	if err := SaveACL("test", "bob", db); err != nil {
+		t.Fatal(err)
+	}
+	c, _ = GetACL("test", db, conf)
+	if !c.IsAllowed("bob", forgeMsg("bob", "ircbot"), nil) {
+		t.Error("The ACL should have been reloaded after a change")
+	}
+	if err := AddGroupMember("sre", "jane", db); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := cached("test", db, conf); ok {
+		t.Error("Changes to groups should invalidate the cache")
+	}
+	// ACLs loaded before a change are not stored.
+	_, generation, _ := cached("test", db, conf)
+	invalidate(db)
+	store("test", db, conf, c, generation)
+	if _, _, ok := cached("test", db, conf); ok {
+		t.Error("A stale ACL was stored in the cache")
+	}
+	// ACLs with expired entries must be reloaded.
+	c.expires = map[string]time.Time{"bob": time.Now().Add(-time.Second)}
+	_, generation, _ = cached("test", db, conf)
+	store("test", db, conf, c, generation)
+	if _, _, ok := cached("test", db, conf); ok {
+		t.Error("An ACL with expired entries should not be served from the cache")
+	}
+}
+
+// BenchmarkGetACL simulates a burst of commands, checking the ACL
+// of each of them with and without the cache.
+func BenchmarkGetACL(b *testing.B) {
+	db, err := openDb()
+	if err != nil {
+		b.Fatal(err)
+	}
+	conf := getConfig()
+	for i := 0; i < 20; i++ {
+		if err := SaveACL("test", fmt.Sprintf("user%d", i), db); err != nil {
+			b.Fatal(err)
+		}
+	}
+	m := forgeMsg("user19", "#sre")
+	getters := map[string]func() (*commandACL, error){
+		"cached":   func() (*commandACL, error) { return GetACL("test", db, conf) },
+		"uncached": func() (*commandACL, error) { return loadACL("test", db, conf) },
+	}
+	for name, get := range getters {
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c, err := get()
+					if err != nil || !c.IsAllowed("user19", m, nil) {
+						b.Error("user19 should be allowed")
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package acl
+
+import (
+	"database/sql"
+	"time"
+)
+
+/*
+	Time-limited ACLs.
+
+	ACL entries can have an expiry time, after which GetACL ignores them.
+	Expired entries are then removed from the database by SweepExpired.
+*/
+
+// Entry is an ACL entry as stored in the database.
+type Entry struct {
+	Command    string
+	Identifier string
+	Deny       bool
+	// The zero time if the entry never expires.
+	Expires time.Time
+}
+
+// Expires returns when the entry for an identifier expires,
+// and false if it never does.
+func (acl *commandACL) Expires(identifier string) (time.Time, bool) {
+	expires, ok := acl.expires[identifier]
+	return expires, ok
+}
+
+// SweepExpired removes the expired ACL entries, and returns them.
+func SweepExpired(db *sql.DB) ([]Entry, error) {
+	expired := make([]Entry, 0)
+	now := time.Now().Unix()
+	rows, err := db.Query("SELECT command, identifier, deny, expires_at FROM acls WHERE expires_at <= ?", now)
+	if err != nil {
+		return expired, err
+	}
+	for rows.Next() {
+		var e Entry
+		var expires int64
+		if err := rows.Scan(&e.Command, &e.Identifier, &e.Deny, &expires); err != nil {
+			rows.Close()
+			return expired, err
+		}
+		e.Expires = time.Unix(expires, 0)
+		expired = append(expired, e)
+	}
+	rows.Close()
+	if len(expired) == 0 {
+		return expired, rows.Err()
+	}
+	defer invalidate(db)
+	_, err = db.Exec("DELETE FROM acls WHERE expires_at <= ?", now)
+	return expired, err
+}
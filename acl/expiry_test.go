@@ -0,0 +1,45 @@
+package acl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	db := getDb(t)
+	until := time.Now().Add(8 * time.Hour).Truncate(time.Second)
+	if err := SaveTemporaryACL("test", "alice", until, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTemporaryACL("test", "bob", time.Now().Add(-time.Minute), db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveACL("test", "jane", db); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetACL("test", db, getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nick, allowed := range map[string]bool{"alice": true, "bob": false, "jane": true} {
+		if c.IsAllowed(nick, forgeMsg(nick, "ircbot"), nil) != allowed {
+			t.Errorf("%s: expected allowed to be %v", nick, allowed)
+		}
+	}
+	if expires, ok := c.Expires("alice"); !ok || !expires.Equal(until) {
+		t.Errorf("alice: expected the ACL to expire at %v, got %v", until, expires)
+	}
+	if _, ok := c.Expires("jane"); ok {
+		t.Error("jane: the ACL should not expire")
+	}
+	expired, err := SweepExpired(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].Identifier != "bob" || expired[0].Command != "test" {
+		t.Errorf("Unexpected expired ACLs: %v", expired)
+	}
+	if ExistsACL("test", "bob", db) || !ExistsACL("test", "alice", db) {
+		t.Error("Only the expired ACL should have been removed")
+	}
+}
@@ -0,0 +1,67 @@
+package acl
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+/*
+	Groups of users.
+
+	ACL identifiers starting with @ refer to a group, like @sre,
+	and are expanded to all the members of the group.
+*/
+
+// IsGroup tells if an ACL identifier refers to a group.
+func IsGroup(identifier string) bool {
+	return strings.HasPrefix(identifier, "@") && len(identifier) > 1 && !IsChannelStatus(identifier)
+}
+
+// GroupMembers returns the members of a group.
+func GroupMembers(group string, db *sql.DB) ([]string, error) {
+	members := make([]string, 0)
+	rows, err := db.Query("SELECT member FROM acl_groups WHERE name = ? ORDER BY member", group)
+	if err != nil {
+		return members, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return members, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func ExistsGroupMember(group string, member string, db *sql.DB) bool {
+	var isPresent int
+	err := db.QueryRow("SELECT count(1) FROM acl_groups WHERE name = ? AND member = ?", group, member).Scan(&isPresent)
+	return err == nil && isPresent == 1
+}
+
+func AddGroupMember(group string, member string, db *sql.DB) error {
+	statement, err := db.Prepare("INSERT INTO acl_groups VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("could not prepare the statement to add a group member: %s", err)
+	}
+	defer statement.Close()
+	// Groups can be part of any ACL.
+	defer invalidate(db)
+	_, err = statement.Exec(group, member)
+	return err
+}
+
+func RemoveGroupMember(group string, member string, db *sql.DB) error {
+	statement, err := db.Prepare("DELETE FROM acl_groups WHERE name = ? AND member = ?")
+	if err != nil {
+		return fmt.Errorf("could not prepare the statement to remove a group member: %s", err)
+	}
+	defer statement.Close()
+	// Groups can be part of any ACL.
+	defer invalidate(db)
+	_, err = statement.Exec(group, member)
+	return err
+}
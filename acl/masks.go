@@ -0,0 +1,74 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/lavagetto/ircbot/bot"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+	Hostmasks.
+
+	ACL identifiers of the form nick!user@host refer to all the users whose
+	full hostmask matches them, like *!*@wikimedia/* for everyone with a
+	wikimedia cloak. * matches any sequence of characters, ? any single
+	character, and the comparison follows the IRC casemapping.
+*/
+
+// IsMask tells if an ACL identifier is a hostmask.
+func IsMask(identifier string) bool {
+	return strings.Contains(identifier, "!") && strings.Contains(identifier, "@")
+}
+
+// hostmask returns the full hostmask of the sender of a message.
+func hostmask(m *hbot.Message) string {
+	if m.Prefix == nil {
+		return ""
+	}
+	return m.Prefix.Name + "!" + m.Prefix.User + "@" + m.Prefix.Host
+}
+
+// matchMask tells if a hostmask matches a mask.
+func matchMask(mask string, hostmask string) bool {
+	return glob(bot.Casefold(mask), bot.Casefold(hostmask))
+}
+
+// glob matches a pattern with * and ? wildcards against a string.
+// When a * fails to match, we backtrack to it and let it match one more character.
+func glob(pattern string, s string) bool {
+	p, i := 0, 0
+	star, backtrack := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, backtrack = p, i
+			p++
+		case star >= 0:
+			backtrack++
+			p, i = star+1, backtrack
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func (ids identifiers) matchesMask(m *hbot.Message) bool {
+	sender := hostmask(m)
+	if sender == "" {
+		return false
+	}
+	for mask := range ids.masks {
+		if matchMask(mask, sender) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package acl
+
+import (
+	"testing"
+
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+func TestMatchMask(t *testing.T) {
+	testCases := []struct {
+		mask     string
+		hostmask string
+		matches  bool
+	}{
+		{"*!*@wikimedia/*", "jane!~jane@wikimedia/jane", true},
+		{"*!*@wikimedia/*", "jane!~jane@wikimedia", false},
+		{"*!*@wikimedia/*", "jane!~jane@example.org/wikimedia/jane", false},
+		{"nick!~user@host.example", "nick!~user@host.example", true},
+		{"nick!~user@host.example", "nick!user@host.example", false},
+		{"nick!?user@host.example", "nick!~user@host.example", true},
+		{"Nick!*@HOST.example", "nick!~user@host.example", true},
+		// rfc1459 casemapping
+		{"foo[]\\~!*@*", "FOO{}|^!~u@h", true},
+		{"*a*b*c", "xaxbxxc", true},
+		{"*a*b*c", "xaxbxxcx", false},
+		{"*", "anything!at@all", true},
+	}
+	for _, tc := range testCases {
+		if matchMask(tc.mask, tc.hostmask) != tc.matches {
+			t.Errorf("%s against %s: expected matching to be %v", tc.mask, tc.hostmask, tc.matches)
+		}
+	}
+}
+
+func TestMaskACL(t *testing.T) {
+	db := getDb(t)
+	if err := SaveACL("test", "*!*@wikimedia/*", db); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetACL("test", db, getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := forgeMsg("jane", "ircbot")
+	m.Prefix = &sx.Prefix{Name: "jane", User: "~jane", Host: "wikimedia/Jane"}
+	// Hostmasks don't depend on the sender being identified.
+	if !c.IsAllowed("", m, nil) {
+		t.Error("The hostmask should be allowed")
+	}
+	m.Prefix.Host = "example.org"
+	if c.IsAllowed("", m, nil) {
+		t.Error("The hostmask should not be allowed")
+	}
+	if masks := c.Dump()["masks"]; len(masks) != 1 || masks[0] != "*!*@wikimedia/*" {
+		t.Errorf("Unexpected masks in the dump: %v", masks)
+	}
+}
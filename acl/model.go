@@ -3,7 +3,9 @@ package acl
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/lavagetto/ircbot/bot"
 
@@ -14,71 +16,200 @@ import (
 	ACLs management.
 */
 type commandACL struct {
+	// The services accounts of the admins of the bot.
+	admins  map[string]bool
+	allowed identifiers
+	denied  identifiers
+	// When the time-limited entries expire, by identifier.
+	expires map[string]time.Time
+}
+
+// identifiers holds ACL entries, by kind.
+type identifiers struct {
+	// Services accounts
 	nicks    map[string]bool
 	channels map[string]bool
+	masks    map[string]bool
+	groups   map[string]bool
+	statuses map[string]bool
+	// Users in a channel
+	scoped map[string]bool
+}
+
+func newIdentifiers() identifiers {
+	return identifiers{
+		nicks:    make(map[string]bool, 0),
+		channels: make(map[string]bool, 0),
+		masks:    make(map[string]bool, 0),
+		groups:   make(map[string]bool, 0),
+		statuses: make(map[string]bool, 0),
+		scoped:   make(map[string]bool, 0),
+	}
 }
 
-func (acl *commandACL) IsAllowed(m *hbot.Message) bool {
-	// First check the nickname
-	if _, ok := acl.nicks[m.Name]; ok {
+func (ids identifiers) add(identifier string) {
+	if IsChannelStatus(identifier) {
+		ids.statuses[identifier] = true
+	} else if IsScoped(identifier) {
+		ids.scoped[identifier] = true
+	} else if IsMask(identifier) {
+		ids.masks[identifier] = true
+	} else if strings.HasPrefix(identifier, "#") {
+		ids.channels[identifier] = true
+	} else {
+		ids.nicks[identifier] = true
+	}
+}
+
+// matchesUser tells if the sender of a message is among the identifiers,
+// either by its account, its hostmask, its status in a channel or its
+// account in the channel the message was sent to.
+func (ids identifiers) matchesUser(account string, m *hbot.Message, state *bot.State) bool {
+	if _, ok := ids.nicks[account]; ok && account != "" {
 		return true
 	}
-	// Then the channel
-	if _, ok := acl.channels[m.To]; ok {
+	return ids.matchesMask(m) || ids.matchesStatus(m, state) || ids.matchesScope(account, m)
+}
+
+// IsAllowed tells if a message can trigger the command. account is the services
+// account of the sender, or an empty string if the sender is not identified,
+// and state is used to know the status of the sender in channels.
+// The first of these rules that applies to the message decides:
+//   - admins are always allowed
+//   - users denied, by account, hostmask, channel status or account in the channel
+//   - users allowed, by account, hostmask, channel status or account in the channel
+//   - channels denied
+//   - channels allowed
+//
+// Anything else is denied. Rules about channels only apply to messages sent
+// to the channel, not to private messages.
+func (acl *commandACL) IsAllowed(account string, m *hbot.Message, state *bot.State) bool {
+	if _, ok := acl.admins[account]; ok && account != "" {
 		return true
 	}
-	return false
+	if acl.denied.matchesUser(account, m, state) {
+		return false
+	}
+	if acl.allowed.matchesUser(account, m, state) {
+		return true
+	}
+	if !isPublic(m) {
+		return false
+	}
+	if _, ok := acl.denied.channels[m.To]; ok {
+		return false
+	}
+	_, ok := acl.allowed.channels[m.To]
+	return ok
 }
 
 // CRD operations on ACLs
 // GetACL returns a full commandACL that can be used in a command.
+// ACLs are cached, see cache.go.
 func GetACL(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, error) {
+	c, generation, ok := cached(ID, db, conf)
+	if ok {
+		return c, nil
+	}
+	c, err := loadACL(ID, db, conf)
+	if err == nil {
+		store(ID, db, conf, c, generation)
+	}
+	return c, err
+}
+
+// loadACL reads an ACL from the database.
+func loadACL(ID string, db *sql.DB, conf *bot.Configuration) (*commandACL, error) {
 	var c commandACL
 	// Admins are always allowed to perform any action.
-	c.nicks = make(map[string]bool, 0)
+	c.admins = make(map[string]bool, 0)
 	for _, admin := range conf.Admins {
-		c.nicks[admin] = true
+		c.admins[admin] = true
 	}
-	c.channels = make(map[string]bool, 0)
-	statement, err := db.Prepare("SELECT identifier FROM acls WHERE command = ?")
+	c.allowed = newIdentifiers()
+	c.denied = newIdentifiers()
+	c.expires = make(map[string]time.Time, 0)
+	// Expired entries are ignored even before they're swept away.
+	statement, err := db.Prepare("SELECT identifier, deny, expires_at FROM acls WHERE command = ? AND (expires_at IS NULL OR expires_at > ?)")
 	if err != nil {
 		return &c, err
 	}
-	rows, err := statement.Query(ID)
+	defer statement.Close()
+	rows, err := statement.Query(ID, time.Now().Unix())
 	if err != nil {
 		return &c, err
 	}
-	defer rows.Close()
+	entries := make(map[string]bool)
 	for rows.Next() {
 		var identifier string
-		err := rows.Scan(&identifier)
+		var deny bool
+		var expires sql.NullInt64
+		err := rows.Scan(&identifier, &deny, &expires)
 		if err != nil {
+			rows.Close()
 			return &c, err
 		}
-		if strings.HasPrefix(identifier, "#") {
-			c.channels[identifier] = true
+		entries[identifier] = deny
+		if expires.Valid {
+			c.expires[identifier] = time.Unix(expires.Int64, 0)
+		}
+	}
+	rows.Close()
+	for identifier, deny := range entries {
+		ids := c.allowed
+		if deny {
+			ids = c.denied
+		}
+		// Groups are expanded to their members.
+		if IsGroup(identifier) {
+			ids.groups[identifier] = true
+			members, err := GroupMembers(strings.TrimPrefix(identifier, "@"), db)
+			if err != nil {
+				return &c, err
+			}
+			for _, member := range members {
+				ids.add(member)
+			}
 		} else {
-			c.nicks[identifier] = true
+			ids.add(identifier)
 		}
 	}
 	return &c, err
 }
 
+func keys(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Dump returns the entries of the ACL by kind: nicks, channels, masks,
+// statuses, scoped (users in channels) and groups, and the same with a denied_ prefix for deny entries.
+// Admins are listed among the nicks.
 func (c *commandACL) Dump() map[string][]string {
-	returnValue := make(map[string][]string, 2)
-	returnValue["channels"] = make([]string, len(c.channels))
-	i := 0
-	for ch := range c.channels {
-		returnValue["channels"][i] = ch
-		i++
+	nicks := make(map[string]bool, len(c.admins)+len(c.allowed.nicks))
+	for _, set := range []map[string]bool{c.admins, c.allowed.nicks} {
+		for nick := range set {
+			nicks[nick] = true
+		}
 	}
-	returnValue["nicks"] = make([]string, len(c.nicks))
-	i = 0
-	for n := range c.nicks {
-		returnValue["nicks"][i] = n
-		i++
+	return map[string][]string{
+		"nicks":           keys(nicks),
+		"channels":        keys(c.allowed.channels),
+		"masks":           keys(c.allowed.masks),
+		"groups":          keys(c.allowed.groups),
+		"statuses":        keys(c.allowed.statuses),
+		"scoped":          keys(c.allowed.scoped),
+		"denied_nicks":    keys(c.denied.nicks),
+		"denied_channels": keys(c.denied.channels),
+		"denied_masks":    keys(c.denied.masks),
+		"denied_groups":   keys(c.denied.groups),
+		"denied_statuses": keys(c.denied.statuses),
+		"denied_scoped":   keys(c.denied.scoped),
 	}
-	return returnValue
 }
 
 func ExistsACL(command string, identifier string, db *sql.DB) bool {
@@ -86,17 +217,44 @@ func ExistsACL(command string, identifier string, db *sql.DB) bool {
 	if err != nil {
 		return false
 	}
+	defer statement.Close()
 	var isPresent int
 	err = statement.QueryRow(command, identifier).Scan(&isPresent)
 	return err == nil && isPresent == 1
 }
 
+// LookupACL tells if the entry for an identifier on a command denies it the
+// use of the command. found is false if there's no such entry.
+func LookupACL(command string, identifier string, db *sql.DB) (deny bool, found bool) {
+	err := db.QueryRow("SELECT deny FROM acls WHERE command = ? AND identifier = ?", command, identifier).Scan(&deny)
+	return deny, err == nil
+}
+
+// SaveACL allows the identifier to use the command.
 func SaveACL(command string, identifier string, db *sql.DB) error {
-	statement, err := db.Prepare("INSERT INTO acls VALUES (?, ?)")
+	return saveACL(command, identifier, false, time.Time{}, db)
+}
+
+// SaveTemporaryACL allows the identifier to use the command until the given time.
+func SaveTemporaryACL(command string, identifier string, until time.Time, db *sql.DB) error {
+	return saveACL(command, identifier, false, until, db)
+}
+
+// DenyACL denies the identifier the use of the command.
+func DenyACL(command string, identifier string, db *sql.DB) error {
+	return saveACL(command, identifier, true, time.Time{}, db)
+}
+
+// saveACL stores an ACL entry. A zero until means the entry never expires.
+func saveACL(command string, identifier string, deny bool, until time.Time, db *sql.DB) error {
+	statement, err := db.Prepare("INSERT INTO acls (command, identifier, deny, expires_at) VALUES (?, ?, ?, ?)")
 	if err != nil {
 		return fmt.Errorf("could not prepare the statement to add ACLs: %s", err)
 	}
-	_, err = statement.Exec(command, identifier)
+	defer statement.Close()
+	defer invalidate(db)
+	expires := sql.NullInt64{Int64: until.Unix(), Valid: !until.IsZero()}
+	_, err = statement.Exec(command, identifier, deny, expires)
 	return err
 }
 
@@ -105,6 +263,8 @@ func DeleteACL(command string, identifier string, db *sql.DB) error {
 	if err != nil {
 		return fmt.Errorf("could not prepare the statement to remove the  ACL: %s", err)
 	}
+	defer statement.Close()
+	defer invalidate(db)
 	_, err = statement.Exec(command, identifier)
 	return err
 }
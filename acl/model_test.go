@@ -0,0 +1,167 @@
+package acl
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/lavagetto/ircbot/bot"
+
+	_ "github.com/mattn/go-sqlite3"
+	hbot "github.com/whyrusleeping/hellabot"
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+// openDb returns an in-memory database with the bot schema loaded.
+func openDb() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection would get its own in-memory database.
+	db.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(string(schema))
+	return db, err
+}
+
+func getDb(t *testing.T) *sql.DB {
+	db, err := openDb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func getConfig() *bot.Configuration {
+	return &bot.Configuration{Admins: []string{"admin"}}
+}
+
+func forgeMsg(nick string, to string) *hbot.Message {
+	prf := sx.Prefix{Name: nick}
+	m := sx.Message{Command: "PRIVMSG", Prefix: &prf}
+	return &hbot.Message{Message: &m, Content: "!test", To: to}
+}
+
+func TestGroups(t *testing.T) {
+	db := getDb(t)
+	for _, member := range []string{"jane", "bob", "#oncall"} {
+		if err := AddGroupMember("sre", member, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveACL("test", "@sre", db); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveACL("test", "alice", db); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		nick    string
+		to      string
+		allowed bool
+	}{
+		{"admin", "ircbot", true},
+		{"alice", "ircbot", true},
+		{"jane", "ircbot", true},
+		{"bob", "#random", true},
+		{"mallory", "#oncall", true},
+		{"mallory", "ircbot", false},
+		{"sre", "ircbot", false},
+		{"@sre", "ircbot", false},
+	}
+	for _, tc := range testCases {
+		c, err := GetACL("test", db, getConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.IsAllowed(tc.nick, forgeMsg(tc.nick, tc.to), nil) != tc.allowed {
+			t.Errorf("%s in %s: expected allowed to be %v", tc.nick, tc.to, tc.allowed)
+		}
+	}
+	// Removing a member from the group revokes its access.
+	if err := RemoveGroupMember("sre", "jane", db); err != nil {
+		t.Fatal(err)
+	}
+	if !ExistsGroupMember("sre", "bob", db) || ExistsGroupMember("sre", "jane", db) {
+		t.Error("Group membership not updated correctly")
+	}
+	c, _ := GetACL("test", db, getConfig())
+	if c.IsAllowed("jane", forgeMsg("jane", "ircbot"), nil) {
+		t.Error("jane should not be allowed after leaving the group")
+	}
+	if groups := c.Dump()["groups"]; len(groups) != 1 || groups[0] != "@sre" {
+		t.Errorf("Unexpected groups in the dump: %v", groups)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	db := getDb(t)
+	for _, identifier := range []string{"admin", "bot", "#random", "*!*@evil.example", "@quiet"} {
+		if err := DenyACL("test", identifier, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// bot is also allowed, as a member of @bots.
+	for _, identifier := range []string{"alice", "@bots", "#sre", "#ops", "*!*@wikimedia/*"} {
+		if err := SaveACL("test", identifier, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddGroupMember("bots", "bot", db); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddGroupMember("quiet", "#ops", db); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		rule    string
+		account string
+		host    string
+		to      string
+		allowed bool
+	}{
+		{"admins are always allowed", "admin", "evil.example", "#random", true},
+		{"user deny beats user allow", "bot", "example.org", "ircbot", false},
+		{"user deny by hostmask beats user allow", "alice", "evil.example", "ircbot", false},
+		{"user deny beats channel allow", "bot", "example.org", "#sre", false},
+		{"user allow", "alice", "example.org", "ircbot", true},
+		{"user allow by hostmask", "", "wikimedia/jane", "ircbot", true},
+		{"user allow beats channel deny", "alice", "example.org", "#random", true},
+		{"channel deny beats channel allow", "mallory", "example.org", "#ops", false},
+		{"channel allow", "mallory", "example.org", "#sre", true},
+		{"channel allow for unidentified users", "", "example.org", "#sre", true},
+		{"anything else is denied", "mallory", "example.org", "ircbot", false},
+	}
+	c, err := GetACL("test", db, getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range testCases {
+		m := forgeMsg("somenick", tc.to)
+		m.Prefix = &sx.Prefix{Name: "somenick", User: "~user", Host: tc.host}
+		if c.IsAllowed(tc.account, m, nil) != tc.allowed {
+			t.Errorf("%s: expected allowed to be %v", tc.rule, tc.allowed)
+		}
+	}
+	data := c.Dump()
+	expected := map[string][]string{
+		"nicks":           {"admin", "alice", "bot"},
+		"channels":        {"#ops", "#sre"},
+		"masks":           {"*!*@wikimedia/*"},
+		"groups":          {"@bots"},
+		"denied_nicks":    {"admin", "bot"},
+		"denied_channels": {"#ops", "#random"},
+		"denied_masks":    {"*!*@evil.example"},
+		"denied_groups":   {"@quiet"},
+	}
+	for kind, values := range expected {
+		if !reflect.DeepEqual(data[kind], values) {
+			t.Errorf("%s: expected %v, got %v", kind, values, data[kind])
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/lavagetto/ircbot/bot"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+	Users in channels.
+
+	ACL identifiers like alice@#sre refer to a user, by account, only when
+	using a command in a channel, so that access can be granted to a user
+	in a channel without granting it everywhere else.
+*/
+
+// parseScope returns the account and the channel of a scoped identifier.
+func parseScope(identifier string) (string, string, bool) {
+	account, channel, ok := strings.Cut(identifier, "@")
+	// Hostmasks can't be scoped.
+	if !ok || account == "" || strings.ContainsAny(account, "!*?") || !strings.HasPrefix(channel, "#") {
+		return "", "", false
+	}
+	return account, channel, true
+}
+
+// IsScoped tells if an ACL identifier refers to a user in a channel.
+func IsScoped(identifier string) bool {
+	_, _, ok := parseScope(identifier)
+	return ok
+}
+
+// isPublic tells if a message was sent to a channel.
+func isPublic(m *hbot.Message) bool {
+	return strings.HasPrefix(m.To, "#") || strings.HasPrefix(m.To, "&")
+}
+
+func (ids identifiers) matchesScope(account string, m *hbot.Message) bool {
+	if account == "" || !isPublic(m) {
+		return false
+	}
+	for identifier := range ids.scoped {
+		user, channel, _ := parseScope(identifier)
+		if user == account && bot.Casefold(channel) == bot.Casefold(m.To) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package acl
+
+import (
+	"testing"
+)
+
+func TestScopes(t *testing.T) {
+	db := getDb(t)
+	for _, identifier := range []string{"alice@#sre", "#ops"} {
+		if err := SaveACL("topic_set", identifier, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DenyACL("topic_set", "bot@#ops", db); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetACL("topic_set", db, getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		account string
+		to      string
+		allowed bool
+	}{
+		{"alice", "#sre", true},
+		{"alice", "#SRE", true},
+		{"alice", "#random", false},
+		// Scoped entries and channels only apply to public messages.
+		{"alice", "ircbot", false},
+		{"mallory", "#ops", true},
+		{"mallory", "ircbot", false},
+		// A user denied in a channel beats the channel being allowed.
+		{"bot", "#ops", false},
+		{"", "#sre", false},
+	}
+	for _, tc := range testCases {
+		if c.IsAllowed(tc.account, forgeMsg("somenick", tc.to), nil) != tc.allowed {
+			t.Errorf("%s in %s: expected allowed to be %v", tc.account, tc.to, tc.allowed)
+		}
+	}
+	data := c.Dump()
+	if len(data["scoped"]) != 1 || data["scoped"][0] != "alice@#sre" || len(data["denied_scoped"]) != 1 {
+		t.Errorf("Unexpected scoped entries in the dump: %v", data)
+	}
+	for identifier, scoped := range map[string]bool{"alice@#sre": true, "@sre": false, "alice@example.org": false, "*!*@#x": false} {
+		if IsScoped(identifier) != scoped {
+			t.Errorf("%s: expected being scoped to be %v", identifier, scoped)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package acl
+
+import (
+	"strings"
+
+	"github.com/lavagetto/ircbot/bot"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+	Channel status.
+
+	ACL identifiers like @op:#sre or +v:#sre refer to whoever currently holds
+	operator or voice status in a channel. +<mode>:#channel works for any
+	status mode the server supports, like +h for half-operators.
+	Channel operators also count as voiced.
+*/
+
+var statusAliases = map[string]rune{
+	"@op":    'o',
+	"@voice": 'v',
+}
+
+// parseStatus returns the channel and the mode of a channel status identifier.
+func parseStatus(identifier string) (string, rune, bool) {
+	prefix, channel, ok := strings.Cut(identifier, ":")
+	if !ok || !strings.HasPrefix(channel, "#") {
+		return "", 0, false
+	}
+	if mode, ok := statusAliases[prefix]; ok {
+		return channel, mode, true
+	}
+	if len(prefix) == 2 && prefix[0] == '+' {
+		return channel, rune(prefix[1]), true
+	}
+	return "", 0, false
+}
+
+// IsChannelStatus tells if an ACL identifier refers to a channel status.
+func IsChannelStatus(identifier string) bool {
+	_, _, ok := parseStatus(identifier)
+	return ok
+}
+
+func (ids identifiers) matchesStatus(m *hbot.Message, state *bot.State) bool {
+	// A message with no sender has no status anywhere.
+	if m.Prefix == nil {
+		return false
+	}
+	for identifier := range ids.statuses {
+		channel, mode, _ := parseStatus(identifier)
+		if state.HasMode(channel, m.Name, mode) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/lavagetto/ircbot/bot"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func TestChannelStatus(t *testing.T) {
+	irc, err := hbot.NewBot("localhost:6667", "IrcBot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := bot.NewState()
+	for _, raw := range []string{
+		":server 353 IrcBot = #sre :@jane +bob @mallory",
+		":server 353 IrcBot = #ops :+bob @alice",
+		":server 353 IrcBot = #trolls :+mallory",
+	} {
+		state.Handle(irc, hbot.ParseMessage(raw))
+	}
+	db := getDb(t)
+	for _, identifier := range []string{"@op:#sre", "+v:#ops"} {
+		if err := SaveACL("test", identifier, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DenyACL("test", "+v:#trolls", db); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetACL("test", db, getConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]bool{
+		"jane":    true,
+		"bob":     true,
+		"alice":   true,
+		"mallory": false,
+		"carol":   false,
+	}
+	for nick, allowed := range testCases {
+		if c.IsAllowed("", forgeMsg(nick, "ircbot"), state) != allowed {
+			t.Errorf("%s: expected allowed to be %v", nick, allowed)
+		}
+	}
+	// Messages with no sender, like the ones forged to check a channel, have no status.
+	m := forgeMsg("", "#sre")
+	m.Prefix = nil
+	if c.IsAllowed("", m, state) {
+		t.Error("A message with no sender should not be allowed by status")
+	}
+	for identifier, isStatus := range map[string]bool{"@op:#sre": true, "+h:#sre": true, "@op": false, "+v:sre": false} {
+		if IsChannelStatus(identifier) != isStatus || (isStatus && IsGroup(identifier)) {
+			t.Errorf("%s: expected being a channel status to be %v", identifier, isStatus)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package acl
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lavagetto/ircbot/bot"
+)
+
+/*
+	Per-channel switches.
+
+	A command can be disabled in a channel, whatever its ACL says, e.g. to
+	keep !sing out of a user-facing channel. Disabling a group of subcommands
+	disables all of them.
+*/
+
+// IsDisabled tells if a command is disabled in a channel.
+func IsDisabled(command string, channel string, db *sql.DB) bool {
+	switches, generation, ok := cachedSwitches(db)
+	if !ok {
+		var err error
+		switches, err = loadSwitches(db)
+		if err != nil {
+			return false
+		}
+		storeSwitches(db, switches, generation)
+	}
+	return switches[switchKey{bot.Casefold(channel), command}]
+}
+
+// loadSwitches reads all the commands disabled in channels from the database.
+func loadSwitches(db *sql.DB) (map[switchKey]bool, error) {
+	switches := make(map[switchKey]bool)
+	rows, err := db.Query("SELECT channel, command FROM disabled_commands")
+	if err != nil {
+		return switches, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key switchKey
+		if err := rows.Scan(&key.channel, &key.command); err != nil {
+			return switches, err
+		}
+		switches[key] = true
+	}
+	return switches, rows.Err()
+}
+
+// DisableCommand disables a command in a channel.
+func DisableCommand(command string, channel string, db *sql.DB) error {
+	statement, err := db.Prepare("INSERT INTO disabled_commands (channel, command) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("could not prepare the statement to disable a command: %s", err)
+	}
+	defer statement.Close()
+	defer invalidate(db)
+	_, err = statement.Exec(bot.Casefold(channel), command)
+	return err
+}
+
+// EnableCommand enables again a command disabled in a channel.
+func EnableCommand(command string, channel string, db *sql.DB) error {
+	statement, err := db.Prepare("DELETE FROM disabled_commands WHERE channel = ? AND command = ?")
+	if err != nil {
+		return fmt.Errorf("could not prepare the statement to enable a command: %s", err)
+	}
+	defer statement.Close()
+	defer invalidate(db)
+	_, err = statement.Exec(bot.Casefold(channel), command)
+	return err
+}
@@ -0,0 +1,42 @@
+package acl
+
+import "testing"
+
+func TestSwitches(t *testing.T) {
+	db := getDb(t)
+	if IsDisabled("sing", "#public", db) {
+		t.Error("Commands should be enabled by default")
+	}
+	if err := DisableCommand("sing", "#Public", db); err != nil {
+		t.Fatal(err)
+	}
+	if !IsDisabled("sing", "#public", db) {
+		t.Error("sing should be disabled in #public, whatever the case of the channel")
+	}
+	if IsDisabled("sing", "#sre", db) || IsDisabled("contact_get", "#public", db) {
+		t.Error("Only sing should be disabled, and only in #public")
+	}
+	if err := DisableCommand("sing", "#public", db); err == nil {
+		t.Error("Disabling a command twice should fail")
+	}
+	if err := EnableCommand("sing", "#PUBLIC", db); err != nil {
+		t.Fatal(err)
+	}
+	if IsDisabled("sing", "#public", db) {
+		t.Error("sing should be enabled again in #public")
+	}
+	// Switches are cached: changes made to the database by other means
+	// are only seen once the cache is invalidated.
+	if _, err := db.Exec("INSERT INTO disabled_commands (channel, command) VALUES ('#public', 'sing')"); err != nil {
+		t.Fatal(err)
+	}
+	if IsDisabled("sing", "#public", db) {
+		t.Error("Switches should have been read from the cache")
+	}
+	if err := DisableCommand("contact", "#public", db); err != nil {
+		t.Fatal(err)
+	}
+	if !IsDisabled("sing", "#public", db) || !IsDisabled("contact", "#public", db) {
+		t.Error("Switches should have been reloaded after a change")
+	}
+}
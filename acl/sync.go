@@ -0,0 +1,125 @@
+package acl
+
+import (
+	"database/sql"
+)
+
+/*
+	ACLs from the configuration.
+
+	ACLs can be declared in the configuration, and are synced to the database
+	at startup. Entries coming from the configuration are marked as such in the
+	source column, so that they're removed once they're not in the
+	configuration anymore, while entries added at runtime are kept unless
+	we're asked to prune them. That includes deny rules for identifiers the
+	configuration allows: someone denied at runtime, e.g. because their
+	account was compromised, must not get access back when the bot restarts.
+*/
+
+// Where ACL entries come from.
+const (
+	SourceConfig  = "config"
+	SourceRuntime = "runtime"
+)
+
+// configActor is the actor recorded in the audit log for changes made by the sync.
+const configActor = "configuration"
+
+type aclKey struct {
+	command    string
+	identifier string
+}
+
+type syncedEntry struct {
+	deny    bool
+	expires sql.NullInt64
+	source  string
+}
+
+// Sync makes the ACLs in the database match the ones in the configuration,
+// given as lists of identifiers by command ID. If prune is true, the entries
+// added at runtime that are not in the configuration are removed too, and
+// the deny rules added at runtime for identifiers in the configuration are
+// replaced by the configuration.
+// It returns the changes made, which are also recorded in the audit log, and
+// the deny rules that were kept despite the configuration allowing them.
+func Sync(acls map[string][]string, prune bool, db *sql.DB) ([]AuditEntry, []Entry, error) {
+	changes := make([]AuditEntry, 0)
+	conflicts := make([]Entry, 0)
+	wanted := make(map[aclKey]bool)
+	for command, identifiers := range acls {
+		for _, identifier := range identifiers {
+			wanted[aclKey{command, identifier}] = true
+		}
+	}
+	existing, err := readEntries(db)
+	if err != nil {
+		return changes, conflicts, err
+	}
+	defer invalidate(db)
+	tx, err := db.Begin()
+	if err != nil {
+		return changes, conflicts, err
+	}
+	for key, entry := range existing {
+		switch {
+		case wanted[key] && entry.deny && !prune:
+			conflicts = append(conflicts, Entry{Command: key.command, Identifier: key.identifier, Deny: true})
+		case wanted[key] && (entry.source != SourceConfig || entry.deny || entry.expires.Valid):
+			// The configuration takes over entries added at runtime.
+			_, err = tx.Exec(
+				"UPDATE acls SET deny = 0, expires_at = NULL, source = ? WHERE command = ? AND identifier = ?",
+				SourceConfig, key.command, key.identifier,
+			)
+			if entry.deny {
+				changes = append(changes, AuditEntry{Actor: configActor, Action: ActionAdd, Command: key.command, Identifier: key.identifier})
+			}
+		case !wanted[key] && (entry.source == SourceConfig || prune):
+			_, err = tx.Exec("DELETE FROM acls WHERE command = ? AND identifier = ?", key.command, key.identifier)
+			changes = append(changes, AuditEntry{Actor: configActor, Action: ActionRemove, Command: key.command, Identifier: key.identifier})
+		}
+		if err != nil {
+			tx.Rollback()
+			return changes[:0], conflicts[:0], err
+		}
+	}
+	for key := range wanted {
+		if _, ok := existing[key]; ok {
+			continue
+		}
+		_, err = tx.Exec(
+			"INSERT INTO acls (command, identifier, deny, source) VALUES (?, ?, 0, ?)",
+			key.command, key.identifier, SourceConfig,
+		)
+		if err != nil {
+			tx.Rollback()
+			return changes[:0], conflicts[:0], err
+		}
+		changes = append(changes, AuditEntry{Actor: configActor, Action: ActionAdd, Command: key.command, Identifier: key.identifier})
+	}
+	for _, change := range changes {
+		if err := audit(change, tx); err != nil {
+			tx.Rollback()
+			return changes[:0], conflicts[:0], err
+		}
+	}
+	return changes, conflicts, tx.Commit()
+}
+
+func readEntries(db *sql.DB) (map[aclKey]syncedEntry, error) {
+	entries := make(map[aclKey]syncedEntry)
+	rows, err := db.Query("SELECT command, identifier, deny, expires_at, source FROM acls")
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key aclKey
+		var entry syncedEntry
+		if err := rows.Scan(&key.command, &key.identifier, &entry.deny, &entry.expires, &entry.source); err != nil {
+			return entries, err
+		}
+		entries[key] = entry
+	}
+	return entries, rows.Err()
+}
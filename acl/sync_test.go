@@ -0,0 +1,70 @@
+package acl
+
+import (
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	db := getDb(t)
+	for _, identifier := range []string{"alice", "#sre"} {
+		if err := SaveACL("contact_get", identifier, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DenyACL("contact_get", "bob", db); err != nil {
+		t.Fatal(err)
+	}
+	config := map[string][]string{
+		"contact_get": {"bob", "@sre"},
+		"contact_add": {"@sre"},
+	}
+	changes, conflicts, err := Sync(config, false, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bob's deny rule is kept, and reported, and the new entries added.
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 changes, got %v", changes)
+	}
+	if len(conflicts) != 1 || conflicts[0].Identifier != "bob" || !conflicts[0].Deny {
+		t.Errorf("Expected bob's deny rule to be reported, got %v", conflicts)
+	}
+	c, _ := GetACL("contact_get", db, getConfig())
+	expected := map[string]bool{"alice": true, "bob": false, "mallory": false}
+	for nick, allowed := range expected {
+		if c.IsAllowed(nick, forgeMsg(nick, "ircbot"), nil) != allowed {
+			t.Errorf("%s: expected allowed to be %v", nick, allowed)
+		}
+	}
+	// Entries removed from the configuration are removed,
+	// runtime ones are kept unless pruning.
+	delete(config, "contact_add")
+	if _, _, err := Sync(config, false, db); err != nil {
+		t.Fatal(err)
+	}
+	if ExistsACL("contact_add", "@sre", db) || !ExistsACL("contact_get", "alice", db) {
+		t.Error("Only entries from the configuration should have been removed")
+	}
+	// When pruning, the configuration also replaces bob's deny rule.
+	changes, conflicts, err = Sync(config, true, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 || len(conflicts) != 0 || ExistsACL("contact_get", "alice", db) || ExistsACL("contact_get", "#sre", db) {
+		t.Errorf("Runtime entries should have been pruned, got %v", changes)
+	}
+	c, _ = GetACL("contact_get", db, getConfig())
+	if !c.IsAllowed("bob", forgeMsg("bob", "ircbot"), nil) {
+		t.Error("bob should be allowed once the deny rule is pruned")
+	}
+	if !ExistsACL("contact_get", "bob", db) || !ExistsACL("contact_get", "@sre", db) {
+		t.Error("Entries from the configuration should have been kept")
+	}
+	// Syncing again changes nothing.
+	if changes, _, _ := Sync(config, true, db); len(changes) != 0 {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+	if _, total, _ := AuditLog("contact_get", 0, 10, db); total != 4 {
+		t.Errorf("Expected 4 changes in the audit log, got %d", total)
+	}
+}
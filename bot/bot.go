@@ -10,8 +10,9 @@ import (
 
 // Bot is the basic bot with a state storage and a database connection.
 type Bot struct {
-	Irc *hbot.Bot
-	DB  *sql.DB
+	Irc   *hbot.Bot
+	DB    *sql.DB
+	State *State
 }
 
 // NewBot returns a new bot instance
@@ -45,7 +46,7 @@ func NewBot(config *Configuration) (*Bot, error) {
 	if err != nil {
 		return nil, err
 	}
-	b := Bot{irc, db}
+	b := Bot{irc, db, NewState()}
 	return &b, nil
 }
 
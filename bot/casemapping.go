@@ -0,0 +1,19 @@
+package bot
+
+import "strings"
+
+// rfc1459 maps the characters that IRC servers consider the uppercase
+// version of others: besides ASCII letters, []\~ are the uppercase of {}|^.
+var rfc1459 = strings.NewReplacer("[", "{", "]", "}", "\\", "|", "~", "^")
+
+// Casefold returns the canonical form of a nickname, channel name or hostmask
+// under the rfc1459 casemapping, so that they can be compared like servers do.
+func Casefold(name string) string {
+	lower := strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, name)
+	return rfc1459.Replace(lower)
+}
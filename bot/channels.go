@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"strings"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+	Channel modes.
+
+	We keep track of the users in the channels we're in, and of the channel
+	operator and voice status they hold, so that ACLs can refer to them.
+	Users and their modes are learned from NAMES when we join a channel,
+	and then kept up to date from JOIN, PART, KICK, QUIT, NICK and MODE.
+*/
+
+// What the server supports, as advertised in RPL_ISUPPORT, with the defaults
+// from RFC 1459 until we know better.
+type serverModes struct {
+	// The modes that give a status in a channel, highest first,
+	// and the prefixes shown in NAMES for each of them.
+	prefixModes string
+	prefixes    string
+	// The other channel modes, by type: always taking a parameter (lists
+	// and settings), taking one only when set, and never taking one.
+	listModes     string
+	settingModes  string
+	paramSetModes string
+}
+
+func defaultServerModes() serverModes {
+	return serverModes{
+		prefixModes:   "ov",
+		prefixes:      "@+",
+		listModes:     "b",
+		settingModes:  "k",
+		paramSetModes: "l",
+	}
+}
+
+// isupport reads the modes supported by the server from RPL_ISUPPORT.
+func (s *State) isupport(tokens []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, token := range tokens {
+		key, value, _ := strings.Cut(token, "=")
+		switch key {
+		case "PREFIX":
+			// e.g. PREFIX=(ov)@+
+			modes, prefixes, ok := strings.Cut(strings.TrimPrefix(value, "("), ")")
+			if ok && len(modes) == len(prefixes) {
+				s.modes.prefixModes = modes
+				s.modes.prefixes = prefixes
+			}
+		case "CHANMODES":
+			// e.g. CHANMODES=eIbq,k,flj,CFLMPQScgimnprstuz
+			types := strings.Split(value, ",")
+			if len(types) >= 3 {
+				s.modes.listModes = types[0]
+				s.modes.settingModes = types[1]
+				s.modes.paramSetModes = types[2]
+			}
+		}
+	}
+}
+
+func (s *State) isMe(irc *hbot.Bot, nick string) bool {
+	return nickKey(nick) == nickKey(irc.Nick)
+}
+
+func (s *State) join(irc *hbot.Bot, channel string, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := Casefold(channel)
+	// NAMES will tell us who is in the channel we just joined.
+	if s.isMe(irc, nick) || s.channels[key] == nil {
+		s.channels[key] = make(map[string]string)
+	}
+	s.channels[key][nickKey(nick)] = ""
+}
+
+func (s *State) part(irc *hbot.Bot, channel string, nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isMe(irc, nick) {
+		delete(s.channels, Casefold(channel))
+		return
+	}
+	delete(s.channels[Casefold(channel)], nickKey(nick))
+}
+
+func (s *State) quit(nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, members := range s.channels {
+		delete(members, nickKey(nick))
+	}
+}
+
+func (s *State) renameMember(oldNick string, newNick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, members := range s.channels {
+		if modes, ok := members[nickKey(oldNick)]; ok {
+			delete(members, nickKey(oldNick))
+			members[nickKey(newNick)] = modes
+		}
+	}
+}
+
+// names adds the users listed in a RPL_NAMREPLY, like "@jane +bob alice".
+func (s *State) names(channel string, names string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := Casefold(channel)
+	if s.channels[key] == nil {
+		s.channels[key] = make(map[string]string)
+	}
+	for _, name := range strings.Fields(names) {
+		// With multi-prefix, a user can have more than one prefix.
+		modes := ""
+		for len(name) > 0 {
+			i := strings.IndexByte(s.modes.prefixes, name[0])
+			if i < 0 {
+				break
+			}
+			modes += string(s.modes.prefixModes[i])
+			name = name[1:]
+		}
+		s.channels[key][nickKey(name)] = modes
+	}
+}
+
+// mode applies a MODE change to a channel, like "+ov-v jane jane bob".
+func (s *State) mode(channel string, params []string) {
+	if len(params) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := s.channels[Casefold(channel)]
+	changes, args := params[0], params[1:]
+	adding := true
+	for _, mode := range changes {
+		switch {
+		case mode == '+':
+			adding = true
+		case mode == '-':
+			adding = false
+		case strings.ContainsRune(s.modes.prefixModes, mode):
+			if len(args) == 0 {
+				return
+			}
+			nick := nickKey(args[0])
+			args = args[1:]
+			current, ok := members[nick]
+			if !ok {
+				continue
+			}
+			current = strings.ReplaceAll(current, string(mode), "")
+			if adding {
+				current += string(mode)
+			}
+			members[nick] = current
+		case strings.ContainsRune(s.modes.listModes+s.modes.settingModes, mode),
+			adding && strings.ContainsRune(s.modes.paramSetModes, mode):
+			// Skip the parameter of modes we don't track.
+			if len(args) > 0 {
+				args = args[1:]
+			}
+		}
+	}
+}
+
+// HasMode tells if a user holds a channel status mode, like 'o' or 'v', or
+// a higher one: channel operators also count as voiced.
+// A nil State knows no channels.
+func (s *State) HasMode(channel string, nick string, mode rune) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	modes, ok := s.channels[Casefold(channel)][nickKey(nick)]
+	if !ok {
+		return false
+	}
+	rank := strings.IndexRune(s.modes.prefixModes, mode)
+	for _, held := range modes {
+		if held == mode {
+			return true
+		}
+		if i := strings.IndexRune(s.modes.prefixModes, held); rank >= 0 && i >= 0 && i <= rank {
+			return true
+		}
+	}
+	return false
+}
@@ -29,24 +29,54 @@ type Configuration struct {
 	PublicChannels []string `json:"public_channels"`
 	// DSN of the database connection.
 	DbDsn string `json:"db_dsn"`
-	// The nicknames of the admins of the bot.
-	// You should take care of ensure their nicknames are
-	// protected
+	// The services accounts of the admins of the bot.
 	Admins []string `json:"admins"`
+	// The prefix commands start with, "!" by default.
+	CommandPrefix string `json:"command_prefix"`
+	// Settings that only apply to a specific channel.
+	ChannelSettings map[string]ChannelSettings `json:"channel_settings"`
+	// ACLs managed in the configuration: the users, channels and groups
+	// allowed to use each command, by command ID. They're synced to the
+	// database at startup.
+	ACLs map[string][]string `json:"acls"`
+	// Also remove ACLs added at runtime that are not in the configuration
+	// when syncing.
+	PruneACLs bool `json:"prune_acls"`
+	// Settings of the modules registered with the bot, by module name.
+	Modules map[string]ModuleSettings `json:"modules"`
 	// Auth credentials file for access to GDocs
 }
 
+// ChannelSettings holds the configuration that can be
+// overridden on a per-channel basis.
+type ChannelSettings struct {
+	// The prefix commands start with in the channel.
+	CommandPrefix string `json:"command_prefix"`
+	// Don't suggest similar commands when an unknown one is invoked.
+	DisableSuggestions bool `json:"disable_suggestions"`
+}
+
+// ModuleSettings holds the configuration of a module.
+type ModuleSettings struct {
+	// Don't load the module, even if it's registered.
+	Disabled bool `json:"disabled"`
+	// The configuration of the module itself, which only the
+	// module knows how to read.
+	Config json.RawMessage `json:"config"`
+}
+
 // GetConfig initializes a configuration object
 // from reading a properly formatted json file
 func GetConfig(fileName string) (*Configuration, error) {
 	config := Configuration{
-		ServerName: "irc.libera.chat",
-		ServerPort: 6697,
-		UseTLS:     true,
-		UseSASL:    true,
-		NickName:   "IrcBot",
-		Channels:   []string{"#somechannel"},
-		DbDsn:      "sqlite3://file:ircbot.db?cache=shared",
+		ServerName:    "irc.libera.chat",
+		ServerPort:    6697,
+		UseTLS:        true,
+		UseSASL:       true,
+		NickName:      "IrcBot",
+		Channels:      []string{"#somechannel"},
+		DbDsn:         "sqlite3://file:ircbot.db?cache=shared",
+		CommandPrefix: "!",
 	}
 	if fileName == "" {
 		return &config, nil
@@ -75,3 +105,41 @@ func (c *Configuration) IsPublicChannel(channel string) bool {
 	i := sort.SearchStrings(c.PublicChannels, channel)
 	return i < len(c.PublicChannels)
 }
+
+// PrefixFor returns the command prefix to use in a channel.
+// Pass an empty channel for private messages.
+func (c *Configuration) PrefixFor(channel string) string {
+	if settings, ok := c.ChannelSettings[channel]; ok && settings.CommandPrefix != "" {
+		return settings.CommandPrefix
+	}
+	if c.CommandPrefix != "" {
+		return c.CommandPrefix
+	}
+	return "!"
+}
+
+// SuggestionsEnabled tells if the bot should suggest similar commands
+// when an unknown one is invoked in a channel.
+func (c *Configuration) SuggestionsEnabled(channel string) bool {
+	settings, ok := c.ChannelSettings[channel]
+	return !ok || !settings.DisableSuggestions
+}
+
+// ModuleEnabled tells if a module should be loaded. Modules are enabled
+// unless disabled in the configuration.
+func (c *Configuration) ModuleEnabled(name string) bool {
+	return !c.Modules[name].Disabled
+}
+
+// IsAdmin tells if a services account is one of the bot admins.
+func (c *Configuration) IsAdmin(account string) bool {
+	if account == "" {
+		return false
+	}
+	for _, admin := range c.Admins {
+		if admin == account {
+			return true
+		}
+	}
+	return false
+}
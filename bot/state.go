@@ -0,0 +1,280 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+/*
+	State of the network.
+
+	ACLs are checked against the services (NickServ) account of users rather
+	than against their nickname, which anyone can take while its owner is offline.
+	Accounts are learned from the IRCv3 account-notify and extended-join
+	capabilities, and looked up with WHOIS when we don't know them yet.
+	The account-tag capability isn't requested, as the message parser we use
+	doesn't support message tags.
+*/
+
+// rplWhoisAccount is the WHOIS reply carrying the account of a user.
+const rplWhoisAccount = "330"
+
+// How long we trust what we know about the account of a nickname,
+// if it's in a channel with us.
+var accountTTL = 10 * time.Minute
+
+// How long we wait for the server to reply to a WHOIS.
+var whoisTimeout = 5 * time.Second
+
+// How long we wait for the account in a WHOIS reply after its end.
+var whoisGrace = 500 * time.Millisecond
+
+type accountInfo struct {
+	nick    string
+	account string
+	seen    time.Time
+}
+
+// A WHOIS sent to the server, and the lookups waiting for its reply.
+type whoisRequest struct {
+	sent time.Time
+	// When the end of the reply was received, if it was.
+	ended   time.Time
+	replies []chan string
+}
+
+// State holds what the bot knows about the users on the network.
+// It's kept up to date by registering it as a handler of the irc bot.
+type State struct {
+	mu sync.Mutex
+	// The services account of users, by nickname.
+	accounts map[string]accountInfo
+	// WHOIS requests waiting for a reply, by nickname.
+	pending map[string]*whoisRequest
+	// The users in the channels we're in, with the status modes they
+	// hold, by channel and nickname.
+	channels map[string]map[string]string
+	modes    serverModes
+}
+
+// NewState returns an empty state.
+func NewState() *State {
+	return &State{
+		accounts: make(map[string]accountInfo),
+		pending:  make(map[string]*whoisRequest),
+		channels: make(map[string]map[string]string),
+		modes:    defaultServerModes(),
+	}
+}
+
+func nickKey(nick string) string {
+	return Casefold(nick)
+}
+
+// Handle updates the state from the messages we receive.
+// It never consumes the message.
+func (s *State) Handle(irc *hbot.Bot, m *hbot.Message) bool {
+	switch m.Command {
+	case sx.RPL_YOURHOST:
+		// hellabot consumes RPL_WELCOME, so we ask for the capabilities we need
+		// right after it.
+		irc.Send("CAP REQ :account-notify extended-join")
+	case "ACCOUNT":
+		s.SetAccount(m.Name, m.Param(0))
+	case sx.RPL_ISUPPORT:
+		s.isupport(m.Params)
+	case sx.JOIN:
+		s.join(irc, m.Param(0), m.Name)
+		// With extended-join, the account comes after the channel.
+		if len(m.Params) >= 3 {
+			s.SetAccount(m.Name, m.Param(1))
+		}
+	case sx.PART:
+		for _, channel := range strings.Split(m.Param(0), ",") {
+			s.part(irc, channel, m.Name)
+		}
+	case sx.KICK:
+		s.part(irc, m.Param(0), m.Param(1))
+	case sx.MODE:
+		if len(m.Params) > 1 {
+			s.mode(m.Param(0), m.Params[1:])
+		}
+	case sx.RPL_NAMREPLY:
+		s.names(m.Param(2), m.Param(3))
+	case sx.NICK:
+		s.rename(m.Name, m.Param(0))
+		s.renameMember(m.Name, m.Param(0))
+	case sx.QUIT:
+		s.forget(m.Name)
+		s.quit(m.Name)
+	case rplWhoisAccount:
+		s.whoisAccount(m.Param(1), m.Param(2), m.TimeStamp)
+	case sx.RPL_ENDOFWHOIS:
+		s.whoisEnd(m.Param(1), m.TimeStamp)
+	}
+	return false
+}
+
+// SetAccount records the account a user is identified to.
+// "*" or an empty account mean the user is not identified.
+func (s *State) SetAccount(nick string, account string) {
+	if account == "*" {
+		account = ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accounts[nickKey(nick)] = accountInfo{nick: nick, account: account, seen: time.Now()}
+}
+
+// A user keeps its account when changing nickname.
+func (s *State) rename(oldNick string, newNick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.accounts[nickKey(oldNick)]; ok {
+		delete(s.accounts, nickKey(oldNick))
+		info.nick = newNick
+		s.accounts[nickKey(newNick)] = info
+	}
+}
+
+func (s *State) forget(nick string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, nickKey(nick))
+}
+
+// whoisAccount answers the pending WHOIS for a nickname with the account in
+// RPL_WHOISACCOUNT, unless it was received after the end of the reply.
+// Each message is handled in its own goroutine, so the replies to a WHOIS
+// can be handled in any order. received is when a reply was read from the
+// server: replies received before the pending WHOIS was sent are ignored,
+// as they answer an earlier request.
+func (s *State) whoisAccount(nick string, account string, received time.Time) {
+	key := nickKey(nick)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, ok := s.pending[key]
+	if !ok || received.Before(request.sent) {
+		return
+	}
+	if !request.ended.IsZero() && received.After(request.ended) {
+		return
+	}
+	s.answerWhois(key, request, nick, account)
+}
+
+// whoisEnd records when RPL_ENDOFWHOIS was received. If RPL_WHOISACCOUNT
+// doesn't show up within whoisGrace, the user is not identified.
+func (s *State) whoisEnd(nick string, received time.Time) {
+	key := nickKey(nick)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, ok := s.pending[key]
+	if !ok || received.Before(request.sent) || !request.ended.IsZero() {
+		return
+	}
+	request.ended = received
+	time.AfterFunc(whoisGrace, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.answerWhois(key, request, nick, "")
+	})
+}
+
+// answerWhois sends the account to the lookups waiting for a WHOIS, if it's
+// still pending. Only accounts we got are cached.
+// It must be called with the lock held.
+func (s *State) answerWhois(key string, request *whoisRequest, nick string, account string) {
+	if s.pending[key] != request {
+		return
+	}
+	delete(s.pending, key)
+	if account != "" {
+		s.accounts[key] = accountInfo{nick: nick, account: account, seen: time.Now()}
+	}
+	for _, reply := range request.replies {
+		reply <- account
+	}
+}
+
+// trusted tells if what we know about the account of a nickname is still valid.
+// We only see users quitting or changing nickname in the channels we share with
+// them: for anyone else, the nickname could have been taken by someone else
+// since we last looked, so we have to look it up again.
+// It must be called with the lock held.
+func (s *State) trusted(key string, info accountInfo) bool {
+	if time.Since(info.seen) >= accountTTL {
+		return false
+	}
+	for _, members := range s.channels {
+		if _, ok := members[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Account returns the services account a user is identified to, or an empty
+// string if the user is not identified. If we don't know the account yet,
+// it's looked up with WHOIS; ok is false if the lookup timed out.
+// Users that don't share a channel with us are looked up every time.
+// A nil State knows no accounts.
+func (s *State) Account(irc *hbot.Bot, nick string) (account string, ok bool) {
+	if s == nil {
+		return "", true
+	}
+	key := nickKey(nick)
+	s.mu.Lock()
+	if info, found := s.accounts[key]; found && s.trusted(key, info) {
+		s.mu.Unlock()
+		return info.account, true
+	}
+	reply := make(chan string, 1)
+	// Only one WHOIS per user at a time.
+	request, found := s.pending[key]
+	if !found {
+		request = &whoisRequest{sent: time.Now()}
+		s.pending[key] = request
+		irc.Send("WHOIS " + nick)
+	}
+	request.replies = append(request.replies, reply)
+	s.mu.Unlock()
+
+	select {
+	case account = <-reply:
+		return account, true
+	case <-time.After(whoisTimeout):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, r := range request.replies {
+			if r == reply {
+				request.replies = append(request.replies[:i], request.replies[i+1:]...)
+				break
+			}
+		}
+		if len(request.replies) == 0 && s.pending[key] == request {
+			delete(s.pending, key)
+		}
+		return "", false
+	}
+}
+
+// Nicks returns the nicknames of the users we know are identified to an account.
+func (s *State) Nicks(account string) []string {
+	nicks := make([]string, 0)
+	if s == nil || account == "" {
+		return nicks
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range s.accounts {
+		if info.account == account && s.trusted(nickKey(info.nick), info) {
+			nicks = append(nicks, info.nick)
+		}
+	}
+	return nicks
+}
@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func getBot() *hbot.Bot {
+	irc, err := hbot.NewBot("localhost:6667", "IrcBot")
+	if err != nil {
+		panic(err)
+	}
+	return irc
+}
+
+// waitForWhois waits for a WHOIS lookup of a nickname to be pending.
+func waitForWhois(s *State, nick string) {
+	for {
+		s.mu.Lock()
+		_, pending := s.pending[nickKey(nick)]
+		s.mu.Unlock()
+		if pending {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStateAccounts(t *testing.T) {
+	irc := getBot()
+	s := NewState()
+	for _, raw := range []string{
+		":jane!j@example.org JOIN #sre jane :Jane Doe",
+		":anon!a@example.org JOIN #sre * :Anonymous",
+		":bob!b@example.org JOIN #sre",
+		":bob!b@example.org ACCOUNT bob",
+		":jane!j@example.org NICK :jane_away",
+		":anon!a@example.org QUIT :bye",
+	} {
+		s.Handle(irc, hbot.ParseMessage(raw))
+	}
+	testCases := map[string]string{
+		"jane_away": "jane",
+		"Bob":       "bob",
+	}
+	for nick, expected := range testCases {
+		if account, ok := s.Account(irc, nick); !ok || account != expected {
+			t.Errorf("%s: expected account %s, got %s", nick, expected, account)
+		}
+	}
+	// Unknown users are looked up with WHOIS.
+	result := make(chan string)
+	go func() {
+		account, _ := s.Account(irc, "alice")
+		result <- account
+	}()
+	waitForWhois(s, "alice")
+	s.Handle(irc, hbot.ParseMessage(":server 330 IrcBot alice alice_account :is logged in as"))
+	s.Handle(irc, hbot.ParseMessage(":server 318 IrcBot alice :End of /WHOIS list."))
+	if account := <-result; account != "alice_account" {
+		t.Errorf("alice: expected account alice_account, got %s", account)
+	}
+	// We forget about users quitting, so we need to ask the server again.
+	// Here nobody replies.
+	whoisTimeout = 10 * time.Millisecond
+	if account, ok := s.Account(irc, "anon"); ok || account != "" {
+		t.Errorf("anon: expected the lookup to time out, got %s", account)
+	}
+	// alice is in no channel with us, so we wouldn't see them quitting:
+	// the account is looked up again.
+	if _, ok := s.Account(irc, "alice"); ok {
+		t.Error("alice: expected a new lookup, which times out")
+	}
+	s.Handle(irc, hbot.ParseMessage(":alice!a@example.org JOIN #sre alice_account :Alice"))
+	if account, ok := s.Account(irc, "alice"); !ok || account != "alice_account" {
+		t.Errorf("alice: expected account alice_account once in #sre, got %s", account)
+	}
+}
+
+func TestStateWhoisOrder(t *testing.T) {
+	irc := getBot()
+	s := NewState()
+	lookup := func() chan string {
+		result := make(chan string, 1)
+		go func() {
+			account, _ := s.Account(irc, "alice")
+			result <- account
+		}()
+		waitForWhois(s, "alice")
+		return result
+	}
+	// A reply read before the WHOIS was sent answers an earlier request.
+	stale := hbot.ParseMessage(":server 330 IrcBot alice old_account :is logged in as")
+	result := lookup()
+	s.Handle(irc, stale)
+	s.Handle(irc, hbot.ParseMessage(":server 330 IrcBot alice alice_account :is logged in as"))
+	if account := <-result; account != "alice_account" {
+		t.Errorf("Expected account alice_account, got %s", account)
+	}
+	// The end of the WHOIS, handled after the reply, changes nothing.
+	s.Handle(irc, hbot.ParseMessage(":server 318 IrcBot alice :End of /WHOIS list."))
+	// The end of the WHOIS can be handled first: the reply received before
+	// it still counts.
+	whoisGrace = 10 * time.Millisecond
+	s.forget("alice")
+	result = lookup()
+	late := hbot.ParseMessage(":server 330 IrcBot alice alice_account :is logged in as")
+	s.Handle(irc, hbot.ParseMessage(":server 318 IrcBot alice :End of /WHOIS list."))
+	s.Handle(irc, late)
+	if account := <-result; account != "alice_account" {
+		t.Errorf("Expected account alice_account, got %s", account)
+	}
+	// Without a reply after a while, the user is not identified,
+	// and the late reply to the earlier WHOIS doesn't leak into this lookup.
+	s.forget("alice")
+	result = lookup()
+	s.Handle(irc, late)
+	s.Handle(irc, hbot.ParseMessage(":server 318 IrcBot alice :End of /WHOIS list."))
+	if account := <-result; account != "" {
+		t.Errorf("A late reply to an earlier WHOIS was used: got %s", account)
+	}
+	// Not being identified isn't remembered.
+	s.mu.Lock()
+	_, cached := s.accounts[nickKey("alice")]
+	s.mu.Unlock()
+	if cached {
+		t.Error("Expected no account to be cached for alice")
+	}
+}
+
+func TestStateChannelModes(t *testing.T) {
+	irc := getBot()
+	s := NewState()
+	for _, raw := range []string{
+		":server 005 IrcBot PREFIX=(qov)~@+ CHANMODES=eIb,k,l,imnpst :are supported by this server",
+		":IrcBot!bot@example.org JOIN #sre",
+		":server 353 IrcBot = #sre :IrcBot ~owner @jane +bob @+alice mallory",
+		":jane!j@example.org MODE #sre +bv-o *!*@evil.example mallory alice",
+		":jane!j@example.org MODE #sre +k-l+o secret bob",
+		":carol!c@example.org JOIN #SRE",
+		":jane!j@example.org KICK #sre owner :bye",
+		":jane!j@example.org NICK jane_away",
+	} {
+		s.Handle(irc, hbot.ParseMessage(raw))
+	}
+	testCases := []struct {
+		nick string
+		mode rune
+		has  bool
+	}{
+		{"jane_away", 'o', true},
+		{"jane_away", 'v', true},
+		{"jane", 'o', false},
+		{"bob", 'o', true},
+		{"alice", 'o', false},
+		{"alice", 'v', true},
+		{"mallory", 'v', true},
+		{"mallory", 'o', false},
+		{"carol", 'v', false},
+		{"owner", 'o', false},
+		{"nobody", 'v', false},
+	}
+	for _, tc := range testCases {
+		if s.HasMode("#Sre", tc.nick, tc.mode) != tc.has {
+			t.Errorf("%s in #sre: expected having %c to be %v", tc.nick, tc.mode, tc.has)
+		}
+	}
+	// We don't know anything about channels we left.
+	s.Handle(irc, hbot.ParseMessage(":IrcBot!bot@example.org PART #sre :leaving"))
+	if s.HasMode("#sre", "bob", 'o') {
+		t.Error("We should have forgotten about #sre")
+	}
+}
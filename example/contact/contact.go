@@ -2,9 +2,11 @@ package contact
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/lavagetto/ircbot/ircbot"
+	"github.com/lavagetto/ircbot/triggers"
 
 	hbot "github.com/whyrusleeping/hellabot"
 )
@@ -64,7 +66,7 @@ func (ct *Contact) Remove(db *sql.DB) error {
 	return err
 }
 
-func addContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot) bool {
+func addContact(args triggers.Args, m *hbot.Message, irc *ircbot.IrcBot) bool {
 	contact := Contact{name: args["name"], phone: args["intl_phone"], email: args["email"]}
 	err := contact.Save(irc.DB())
 	if err == nil {
@@ -76,7 +78,7 @@ func addContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot) boo
 	return true
 }
 
-func removeContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot) bool {
+func removeContact(args triggers.Args, m *hbot.Message, irc *ircbot.IrcBot) bool {
 	db := irc.DB()
 	log := irc.Logger()
 	contact, err := GetContact(db, args["name"])
@@ -95,7 +97,7 @@ func removeContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot)
 	return true
 }
 
-func getContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot) bool {
+func getContact(args triggers.Args, m *hbot.Message, irc *ircbot.IrcBot) bool {
 	db := irc.DB()
 	log := irc.Logger()
 	contact, err := GetContact(db, args["name"])
@@ -110,9 +112,37 @@ func getContact(args map[string]string, m *hbot.Message, irc *ircbot.IrcBot) boo
 	return true
 }
 
-func AddContact(irc *ircbot.IrcBot) {
-	add := irc.AddCommand("contact_add", addContact).SetHelp("Add a contact (privmsg only)")
-	add.AddParameter("name", `\w+`).AddParameter("intl_phone", `\+\d{5,15}`).AddParameter("email", `\S+`).AllowPrivate()
-	irc.AddCommand("contact_get", getContact).SetHelp("Gets information about a contact (privmsg only)").AddParameter("name", `\w+`).AllowPrivate()
-	irc.AddCommand("contact_remove", removeContact).SetHelp("Removes a contact (privmsg only)").AddParameter("name", `\w+`).AllowPrivate()
+// Names can have spaces in them, if quoted: "Jane Doe".
+const namePattern = `\w[\w ]*`
+
+// Module is the contact list, as a module of the bot.
+type Module struct {
+	ircbot.BaseModule
+}
+
+// New returns the contact list module.
+func New() *Module {
+	return &Module{}
+}
+
+func (mod *Module) Name() string {
+	return "contact"
+}
+
+func (mod *Module) Migrations() []string {
+	return []string{
+		// The table was part of the bot schema before the module existed.
+		"CREATE TABLE IF NOT EXISTS contacts (`name` VARCHAR(256) PRIMARY KEY, `phone` VARCHAR(256), `email` VARCHAR(256))",
+	}
+}
+
+func (mod *Module) Setup(irc *ircbot.IrcBot, config json.RawMessage) error {
+	contact := irc.AddCommandGroup("contact").SetHelp("Manages the contact list (privmsg only)")
+	add := irc.AddSubcommand(contact, "add", addContact).SetHelp("Add a contact (privmsg only)")
+	add.AddParameter("name", namePattern).AddParameter("intl_phone", `\+\d{5,15}`).AddEmailParameter("email").AllowPrivate()
+	add.Describe("name", "The name of the contact", "jane").Describe("intl_phone", "The phone number in international format", "+3912345678")
+	add.Describe("email", "The email address", "jane@example.org").AddExample(`contact add "Jane Doe" +3912345678 jane@example.org`)
+	irc.AddSubcommand(contact, "get", getContact).AddAlias("c").SetHelp("Gets information about a contact (privmsg only)").AddParameter("name", namePattern).AllowPrivate()
+	irc.AddSubcommand(contact, "remove", removeContact).SetHelp("Removes a contact (privmsg only)").AddParameter("name", namePattern).AllowPrivate()
+	return nil
 }
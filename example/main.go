@@ -21,6 +21,7 @@ import (
 
 	"github.com/lavagetto/ircbot/example/contact"
 	"github.com/lavagetto/ircbot/ircbot"
+	"github.com/lavagetto/ircbot/triggers"
 	hbot "github.com/whyrusleeping/hellabot"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -34,7 +35,7 @@ func nameFromMsg(m *hbot.Message) string {
 }
 
 // Very basic example. For a more complex one see the contact module
-func sayHello(args map[string]string, m *hbot.Message, i *ircbot.IrcBot) bool {
+func sayHello(args triggers.Args, m *hbot.Message, i *ircbot.IrcBot) bool {
 	i.Reply(m, fmt.Sprintf("Hello, %s!", args["name"]))
 	return true
 }
@@ -48,6 +49,8 @@ func main() {
 	// Add one command
 	irc.AddCommand("greet", sayHello).AddParameterWithDefaultCb("name", `\w+`, nameFromMsg).SetHelp("Cheer the counterpart").AllowChannel()
 	// Add commands from the contact list module
-	contact.AddContact(irc)
+	if err := irc.RegisterModule(contact.New()); err != nil {
+		panic(err)
+	}
 	irc.Run()
 }
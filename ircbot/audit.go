@@ -0,0 +1,97 @@
+package ircbot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// How many changes !acl_log shows per page.
+const auditPageSize = 10
+
+// actor returns who sent a message, as recorded in the audit log:
+// the account of the sender, or its nickname if not identified.
+func (irc *IrcBot) actor(m *hbot.Message) string {
+	account, _ := irc.bot.State.Account(irc.bot.Irc, m.Name)
+	if account == "" {
+		return fmt.Sprintf("%s (not identified)", m.Name)
+	}
+	return account
+}
+
+// audit records a change made by the sender of a message in the audit log.
+func (irc *IrcBot) audit(m *hbot.Message, action string, command string, identifier string) {
+	entry := acl.AuditEntry{
+		Actor:      irc.actor(m),
+		Action:     action,
+		Command:    command,
+		Identifier: identifier,
+	}
+	if strings.HasPrefix(m.To, "#") {
+		entry.Channel = m.To
+	}
+	if err := acl.Audit(entry, irc.DB()); err != nil {
+		irc.Logger().Error("Problem recording the ACL change:", "error", err.Error())
+	}
+}
+
+// describeChange returns a human readable description of a change in the audit log.
+func describeChange(e acl.AuditEntry) string {
+	var what string
+	switch e.Action {
+	case acl.ActionAdd:
+		what = fmt.Sprintf("%s allowed %s to use %s", e.Actor, e.Identifier, e.Command)
+	case acl.ActionDeny:
+		what = fmt.Sprintf("%s denied %s the use of %s", e.Actor, e.Identifier, e.Command)
+	case acl.ActionRemove:
+		what = fmt.Sprintf("%s removed %s from the ACL of %s", e.Actor, e.Identifier, e.Command)
+	case acl.ActionExpire:
+		what = fmt.Sprintf("the access of %s to %s expired", e.Identifier, e.Command)
+	case acl.ActionGroupAdd:
+		what = fmt.Sprintf("%s added %s to %s", e.Actor, e.Identifier, e.Command)
+	case acl.ActionGroupRemove:
+		what = fmt.Sprintf("%s removed %s from %s", e.Actor, e.Identifier, e.Command)
+	case acl.ActionDisable:
+		what = fmt.Sprintf("%s disabled %s for %s", e.Actor, e.Command, e.Identifier)
+	case acl.ActionEnable:
+		what = fmt.Sprintf("%s enabled %s for %s", e.Actor, e.Command, e.Identifier)
+	default:
+		what = fmt.Sprintf("%s: %s %s %s", e.Actor, e.Action, e.Command, e.Identifier)
+	}
+	if e.Channel != "" {
+		what = fmt.Sprintf("%s in %s", what, e.Channel)
+	}
+	return fmt.Sprintf("[%s] %s", e.Time.UTC().Format("2006-01-02 15:04 MST"), what)
+}
+
+func readAclLog(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	command := args["command"]
+	if command == "*" {
+		command = ""
+	}
+	page := args.Int("page")
+	if page < 1 {
+		page = 1
+	}
+	entries, total, err := acl.AuditLog(command, (page-1)*auditPageSize, auditPageSize, irc.DB())
+	if err != nil {
+		irc.Reply(m, "Could not fetch the ACL changes:")
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if len(entries) == 0 {
+		irc.Reply(m, "No ACL changes found.")
+		return true
+	}
+	for _, entry := range entries {
+		irc.Reply(m, describeChange(entry))
+	}
+	pages := (total + auditPageSize - 1) / auditPageSize
+	if page < pages {
+		irc.Reply(m, fmt.Sprintf("Page %d of %d, use --page %d to see older changes.", page, pages, page+1))
+	}
+	return true
+}
@@ -1,10 +1,12 @@
 package ircbot
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 
 	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/triggers"
 	hbot "github.com/whyrusleeping/hellabot"
 )
 
@@ -32,7 +34,7 @@ var lyrics = []string{
 	"Never gonna tell a lie and hurt you",
 }
 
-func sing(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
+func sing(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
 	for _, line := range lyrics {
 		irc.Reply(m, line)
 		time.Sleep(800 * time.Millisecond)
@@ -40,68 +42,133 @@ func sing(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
 	return true
 }
 
-func porcessAclParams(args map[string]string, m *hbot.Message, irc *IrcBot) (string, string, bool) {
-	command, ok := args["command"]
+// resolveCommand returns the ID of the command with the given name or alias.
+// It replies and returns false if there's no such command.
+func (irc *IrcBot) resolveCommand(name string, m *hbot.Message) (string, bool) {
+	command := irc.registry.Resolve(name)
+	if !irc.registry.IsCommand(command) {
+		irc.Reply(m, fmt.Sprintf("%s: no such command.", name))
+		return "", false
+	}
+	return command, true
+}
+
+// aclCommand returns the ID of the command an ACL is about. Groups of
+// subcommands have no ACL of their own, each subcommand has one.
+func (irc *IrcBot) aclCommand(name string, m *hbot.Message) (string, bool) {
+	command, ok := irc.resolveCommand(name, m)
+	if !ok {
+		return "", false
+	}
+	if irc.registry.IsGroup(command) {
+		irc.Reply(m, fmt.Sprintf("%s: ACLs are set on each of its subcommands, like %s_%s.", command, command, irc.registry.Subcommands(command)[0]))
+		return "", false
+	}
+	return command, true
+}
+
+func porcessAclParams(args triggers.Args, m *hbot.Message, irc *IrcBot) (string, []string, bool) {
+	name, ok := args["command"]
 	if !ok {
 		irc.Reply(m, "Somehow we got the wrong number of arguments.")
-		return "", "", false
+		return "", nil, false
 	}
-	identifier, ok := args["nick_or_chan"]
+	command, ok := irc.aclCommand(name, m)
 	if !ok {
+		return "", nil, false
+	}
+	identifiers := args.List("nick_or_chan")
+	if len(identifiers) == 0 {
 		irc.Reply(m, "Somehow we got the wrong number of arguments.")
-		return "", "", false
+		return "", nil, false
 	}
-	return command, identifier, true
+	return command, identifiers, true
 }
 
 // IRC actions
-func addACL(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
-	command, identifier, ok := porcessAclParams(args, m, irc)
+func addACL(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	// Grants can be time-limited.
+	if duration := args.Duration("for"); duration > 0 {
+		until := time.Now().Add(duration)
+		return saveAcls(args, m, irc, acl.ActionAdd, func(command string, identifier string, db *sql.DB) error {
+			return acl.SaveTemporaryACL(command, identifier, until, db)
+		})
+	}
+	return saveAcls(args, m, irc, acl.ActionAdd, acl.SaveACL)
+}
+
+// Special command to deny the use of a command
+func denyAcl(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	return saveAcls(args, m, irc, acl.ActionDeny, acl.DenyACL)
+}
+
+func saveAcls(args triggers.Args, m *hbot.Message, irc *IrcBot, action string, save func(string, string, *sql.DB) error) bool {
+	command, identifiers, ok := porcessAclParams(args, m, irc)
 	if !ok {
 		return false
 	}
-	// First let's check if the ACL is already present.
-	if acl.ExistsACL(command, identifier, irc.DB()) {
-		irc.Reply(m, "This ACL is already present.")
-		return false
-	} else {
-		err := acl.SaveACL(command, identifier, irc.DB())
+	allSaved := true
+	for _, identifier := range identifiers {
+		// First let's check if the ACL is already present: an identifier
+		// has a single entry per command, either allowing or denying it.
+		if deny, found := acl.LookupACL(command, identifier, irc.DB()); found {
+			switch {
+			case deny == (action == acl.ActionDeny):
+				irc.Reply(m, fmt.Sprintf("%s: this ACL is already present.", identifier))
+			case deny:
+				irc.Reply(m, fmt.Sprintf("%s: already denied the use of %s, remove that ACL first.", identifier, command))
+			default:
+				irc.Reply(m, fmt.Sprintf("%s: already allowed to use %s, remove that ACL first.", identifier, command))
+			}
+			allSaved = false
+			continue
+		}
+		err := save(command, identifier, irc.DB())
 		if err != nil {
 			irc.Logger().Error("Problem saving ACLs:", "error", err.Error())
-			irc.Reply(m, "Couldn't save the new ACL.")
-			return false
+			irc.Reply(m, fmt.Sprintf("%s: couldn't save the new ACL.", identifier))
+			allSaved = false
+			continue
 		}
+		irc.audit(m, action, command, identifier)
+		irc.Reply(m, fmt.Sprintf("%s: the ACL was saved.", identifier))
 	}
-	irc.Reply(m, "The ACL was saved.")
-	return true
+	return allSaved
 }
 
 // Special command to remove an acl rule
-func removeAcl(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
-	command, identifier, ok := porcessAclParams(args, m, irc)
+func removeAcl(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	command, identifiers, ok := porcessAclParams(args, m, irc)
 	if !ok {
 		return false
 	}
 	db := irc.DB()
-
-	// First let's check if the ACL is already present.
-	if !acl.ExistsACL(command, identifier, db) {
-		irc.Reply(m, "This ACL is not present.")
-		return false
-	} else {
+	allRemoved := true
+	for _, identifier := range identifiers {
+		// First let's check if the ACL is already present.
+		if !acl.ExistsACL(command, identifier, db) {
+			irc.Reply(m, fmt.Sprintf("%s: this ACL is not present.", identifier))
+			allRemoved = false
+			continue
+		}
 		err := acl.DeleteACL(command, identifier, db)
 		if err != nil {
 			irc.Logger().Error("Problem removing ACLs:", "error", err.Error())
-			irc.Reply(m, "Couldn't remove the ACL.")
-			return false
+			irc.Reply(m, fmt.Sprintf("%s: couldn't remove the ACL.", identifier))
+			allRemoved = false
+			continue
 		}
+		irc.audit(m, acl.ActionRemove, command, identifier)
+		irc.Reply(m, fmt.Sprintf("%s: the ACL was succesfully removed.", identifier))
 	}
-	irc.Reply(m, "The ACL was succesfully removed.")
-	return true
+	return allRemoved
 }
 
-func readAcl(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
-	command := args["command"]
+func readAcl(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	command, ok := irc.aclCommand(args["command"], m)
+	if !ok {
+		return false
+	}
 	myAcl, err := acl.GetACL(command, irc.DB(), irc.Config())
 	if err != nil {
 		irc.Reply(m, "Could not fetch the requested ACL:")
@@ -109,19 +176,123 @@ func readAcl(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
 		return true
 	}
 	data := myAcl.Dump()
+	// Show how long time-limited entries are still valid.
+	for kind, items := range data {
+		for i, item := range items {
+			if expires, ok := myAcl.Expires(item); ok {
+				data[kind][i] = fmt.Sprintf("%s (expires in %s)", item, remaining(expires))
+			}
+		}
+	}
 	irc.Reply(m, fmt.Sprintf("ACL for %s", command))
-	irc.Reply(m, "Users:")
-	for _, nick := range data["nicks"] {
-		irc.Reply(m, fmt.Sprintf("\t%s", nick))
+	users := !args.Bool("channels-only")
+	channels := !args.Bool("users-only")
+	replyList(irc, m, "Users:", data["nicks"], users, true)
+	replyList(irc, m, "Channels:", data["channels"], channels, true)
+	replyList(irc, m, "Hostmasks:", data["masks"], users, false)
+	replyList(irc, m, "Users in channels:", data["scoped"], users || channels, false)
+	replyList(irc, m, "Channel status:", data["statuses"], users, false)
+	replyList(irc, m, "Groups:", data["groups"], true, false)
+	replyList(irc, m, "Denied users:", data["denied_nicks"], users, false)
+	replyList(irc, m, "Denied channels:", data["denied_channels"], channels, false)
+	replyList(irc, m, "Denied hostmasks:", data["denied_masks"], users, false)
+	replyList(irc, m, "Denied users in channels:", data["denied_scoped"], users || channels, false)
+	replyList(irc, m, "Denied channel status:", data["denied_statuses"], users, false)
+	replyList(irc, m, "Denied groups:", data["denied_groups"], true, false)
+	return true
+}
+
+// replyList replies with a title followed by a list of items, if show is true.
+// Empty lists are only shown if showEmpty is true.
+func replyList(irc *IrcBot, m *hbot.Message, title string, items []string, show bool, showEmpty bool) {
+	if !show || (len(items) == 0 && !showEmpty) {
+		return
+	}
+	irc.Reply(m, title)
+	for _, item := range items {
+		irc.Reply(m, fmt.Sprintf("\t%s", item))
+	}
+}
+
+func processGroupParams(args triggers.Args, m *hbot.Message, irc *IrcBot) (string, []string, bool) {
+	members := args.List("members")
+	if len(members) == 0 {
+		irc.Reply(m, "Somehow we got the wrong number of arguments.")
+		return "", nil, false
+	}
+	return args["group"], members, true
+}
+
+func addGroupMembers(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	group, members, ok := processGroupParams(args, m, irc)
+	if !ok {
+		return false
+	}
+	allSaved := true
+	for _, member := range members {
+		if acl.ExistsGroupMember(group, member, irc.DB()) {
+			irc.Reply(m, fmt.Sprintf("%s: already a member of @%s.", member, group))
+			allSaved = false
+			continue
+		}
+		err := acl.AddGroupMember(group, member, irc.DB())
+		if err != nil {
+			irc.Logger().Error("Problem saving group members:", "error", err.Error())
+			irc.Reply(m, fmt.Sprintf("%s: couldn't add to @%s.", member, group))
+			allSaved = false
+			continue
+		}
+		irc.audit(m, acl.ActionGroupAdd, "@"+group, member)
+		irc.Reply(m, fmt.Sprintf("%s: added to @%s.", member, group))
+	}
+	return allSaved
+}
+
+func removeGroupMembers(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	group, members, ok := processGroupParams(args, m, irc)
+	if !ok {
+		return false
+	}
+	allRemoved := true
+	for _, member := range members {
+		if !acl.ExistsGroupMember(group, member, irc.DB()) {
+			irc.Reply(m, fmt.Sprintf("%s: not a member of @%s.", member, group))
+			allRemoved = false
+			continue
+		}
+		err := acl.RemoveGroupMember(group, member, irc.DB())
+		if err != nil {
+			irc.Logger().Error("Problem removing group members:", "error", err.Error())
+			irc.Reply(m, fmt.Sprintf("%s: couldn't remove from @%s.", member, group))
+			allRemoved = false
+			continue
+		}
+		irc.audit(m, acl.ActionGroupRemove, "@"+group, member)
+		irc.Reply(m, fmt.Sprintf("%s: removed from @%s.", member, group))
+	}
+	return allRemoved
+}
+
+func readGroup(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	group := args["group"]
+	members, err := acl.GroupMembers(group, irc.DB())
+	if err != nil {
+		irc.Reply(m, "Could not fetch the requested group:")
+		irc.Reply(m, err.Error())
+		return true
+	}
+	if len(members) == 0 {
+		irc.Reply(m, fmt.Sprintf("The group @%s has no members.", group))
+		return true
 	}
-	irc.Reply(m, "Channels:")
-	for _, channel := range data["channels"] {
-		irc.Reply(m, fmt.Sprintf("\t%s", channel))
+	irc.Reply(m, fmt.Sprintf("Members of @%s:", group))
+	for _, member := range members {
+		irc.Reply(m, fmt.Sprintf("\t%s", member))
 	}
 	return true
 }
 
-func changePass(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
+func changePass(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
 	newPass := args["new_password"]
 	// Make a message to nickserv. I know this is hacky, but better than forging a message from scratch.
 	requestor := m.From
@@ -132,7 +303,7 @@ func changePass(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
 	return false
 }
 
-func part(args map[string]string, m *hbot.Message, irc *IrcBot) bool {
+func part(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
 	for _, ch := range irc.Config().Channels {
 		irc.bot.Irc.Part(ch, "leaving.")
 	}
@@ -0,0 +1,72 @@
+package ircbot
+
+import (
+	"testing"
+
+	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+func TestAclAliases(t *testing.T) {
+	irc := getIrcBot(t)
+	contact := irc.AddCommandGroup("contact")
+	irc.AddSubcommand(contact, "get", sing).AddAlias("c")
+	for _, cmd := range []*triggers.Command{contact, irc.AddCommand("sing", sing)} {
+		if err := irc.registry.RegisterCommand(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	irc.bot.State.Handle(irc.bot.Irc, hbot.ParseMessage(":admin!a@example.org JOIN #sre admin :Admin"))
+	m := &hbot.Message{Message: &sx.Message{Command: sx.PRIVMSG, Prefix: &sx.Prefix{Name: "admin"}}, To: "IrcBot"}
+	testCases := map[string]string{
+		"sing":        "sing",
+		"c":           "contact_get",
+		"contact_get": "contact_get",
+		// Groups have no ACL, and typos are not commands.
+		"contact": "",
+		"snig":    "",
+	}
+	for name, expected := range testCases {
+		command, ok := irc.aclCommand(name, m)
+		if command != expected || ok != (expected != "") {
+			t.Errorf("%s: expected %q, got %q", name, expected, command)
+		}
+	}
+	// ACLs added with an alias are saved for the command itself.
+	if !addACL(triggers.Args{"command": "c", "nick_or_chan": "alice"}, m, irc) {
+		t.Error("The ACL was not saved")
+	}
+	if !acl.ExistsACL("contact_get", "alice", irc.DB()) || acl.ExistsACL("c", "alice", irc.DB()) {
+		t.Error("The ACL should have been saved for contact_get")
+	}
+}
+
+func TestAclDenyConflicts(t *testing.T) {
+	irc := getIrcBot(t)
+	if err := irc.registry.RegisterCommand(irc.AddCommand("sing", sing)); err != nil {
+		t.Fatal(err)
+	}
+	irc.bot.State.Handle(irc.bot.Irc, hbot.ParseMessage(":admin!a@example.org JOIN #sre admin :Admin"))
+	m := &hbot.Message{Message: &sx.Message{Command: sx.PRIVMSG, Prefix: &sx.Prefix{Name: "admin"}}, To: "IrcBot"}
+	if !addACL(triggers.Args{"command": "sing", "nick_or_chan": "bob"}, m, irc) {
+		t.Fatal("The ACL was not saved")
+	}
+	// bob is allowed, so they can't be denied until that's removed.
+	if denyAcl(triggers.Args{"command": "sing", "nick_or_chan": "bob"}, m, irc) {
+		t.Error("bob was denied while allowed")
+	}
+	if deny, found := acl.LookupACL("sing", "bob", irc.DB()); !found || deny {
+		t.Error("bob should still be allowed")
+	}
+	if !removeAcl(triggers.Args{"command": "sing", "nick_or_chan": "bob"}, m, irc) || !denyAcl(triggers.Args{"command": "sing", "nick_or_chan": "bob"}, m, irc) {
+		t.Fatal("bob should have been denied")
+	}
+	if addACL(triggers.Args{"command": "sing", "nick_or_chan": "bob"}, m, irc) {
+		t.Error("bob was allowed while denied")
+	}
+	if deny, found := acl.LookupACL("sing", "bob", irc.DB()); !found || !deny {
+		t.Error("bob should still be denied")
+	}
+}
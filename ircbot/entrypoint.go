@@ -2,7 +2,9 @@ package ircbot
 
 import (
 	"database/sql"
+	"fmt"
 
+	"github.com/lavagetto/ircbot/acl"
 	"github.com/lavagetto/ircbot/bot"
 	"github.com/lavagetto/ircbot/triggers"
 	"github.com/lavagetto/ircbot/utils"
@@ -22,6 +24,8 @@ type IrcBot struct {
 	registry *triggers.Registry
 	// List of irc commands added via the AddCommand interface
 	ircCommands []*triggers.Command
+	// Modules registered via RegisterModule, in order
+	modules []*registeredModule
 }
 
 // Initializes the bot.
@@ -62,10 +66,30 @@ func (irc *IrcBot) Run() {
 	// We need to only register commands here because
 	// the registry dereferences them.
 	for _, command := range irc.ircCommands {
-		irc.registry.RegisterCommand(command)
+		if err := irc.registry.RegisterCommand(command); err != nil {
+			irc.Logger().Error("Could not register the command:", "command", command.ID, "error", err.Error())
+		}
 	}
 	irc.registry.AddAll(irc.bot, irc.Config())
+	changes, conflicts, err := acl.Sync(irc.Config().ACLs, irc.Config().PruneACLs, irc.DB())
+	if err != nil {
+		irc.Logger().Error("Could not sync the ACLs from the configuration:", "error", err.Error())
+	}
+	for _, change := range changes {
+		irc.Logger().Info("Synced ACL from the configuration", "action", change.Action, "command", change.Command, "identifier", change.Identifier)
+	}
+	for _, conflict := range conflicts {
+		irc.Logger().Warn("Kept a deny rule for an identifier allowed in the configuration", "command", conflict.Command, "identifier", conflict.Identifier)
+	}
+	if err := acl.LoadCache(irc.DB(), irc.Config()); err != nil {
+		irc.Logger().Error("Could not load the ACLs:", "error", err.Error())
+	}
 	defer irc.DB().Close()
+	done := make(chan struct{})
+	defer close(done)
+	go irc.sweepAcls(done)
+	irc.startModules()
+	defer irc.stopModules()
 	irc.bot.Irc.Run()
 }
 
@@ -106,27 +130,78 @@ func (irc *IrcBot) Logger() log.Logger {
 
 // Adds a non-configured command to the registry, that can be then configured.
 func (irc *IrcBot) AddCommand(name string, action CommandAction) *triggers.Command {
-	CommandClosure := func(args map[string]string, bot *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
-		return action(args, m, irc)
+	c := &triggers.Command{
+		ID:            name,
+		Action:        irc.closure(action),
+		Db:            irc.DB(),
+		Configuration: irc.Config(),
+		State:         irc.bot.State,
 	}
+	c.InitParams()
+	irc.ircCommands = append(irc.ircCommands, c)
+	return c
+}
+
+// Adds a group of subcommands to the registry. Subcommands
+// can then be added to it with AddSubcommand.
+func (irc *IrcBot) AddCommandGroup(name string) *triggers.Command {
 	c := &triggers.Command{
 		ID:            name,
-		Action:        CommandClosure,
 		Db:            irc.DB(),
 		Configuration: irc.Config(),
+		State:         irc.bot.State,
 	}
 	c.InitParams()
 	irc.ircCommands = append(irc.ircCommands, c)
 	return c
 }
 
+// Adds a subcommand to a command. It will be invoked as
+// !<command> <name>, or as !<command>_<name>.
+func (irc *IrcBot) AddSubcommand(parent *triggers.Command, name string, action CommandAction) *triggers.Command {
+	return parent.AddSubcommand(name, irc.closure(action))
+}
+
+func (irc *IrcBot) closure(action CommandAction) triggers.CommandClosure {
+	return func(args triggers.Args, bot *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+		return action(args, m, irc)
+	}
+}
+
 func (irc *IrcBot) AddBuiltins(showHelp bool) {
 	sing := irc.AddCommand("sing", sing).AllowChannel().AllowPrivate()
-	irc.addAclCommand("acl_add", "Adds the ability for a command to be used by a single user or in a channel", addACL, showHelp)
-	irc.addAclCommand("acl_remove", "Removes a user/channel from the ACL", removeAcl, showHelp)
-	irc.addAclCommand("acl_get", "Gets the defined ACLs for a command", readAcl, showHelp)
+	acls := irc.AddCommandGroup("acl")
+	irc.addAclCommand(acls, "add", "Adds the ability for a command to be used by a single user or in a channel", addACL, showHelp)
+	irc.addAclCommand(acls, "remove", "Removes a user/channel from the ACL", removeAcl, showHelp)
+	irc.addAclCommand(acls, "deny", "Denies a user or a channel the use of a command", denyAcl, showHelp)
+	aclLog := irc.AddSubcommand(acls, "log", readAclLog).AllowPrivate()
+	aclLog.AddParameterWithDefault("command", `\*|@?\w+`, "*").AddOption("page", "p", `\d+`, "1")
+	aclLog.Describe("command", "The ID of the command, or @group for changes to a group", "contact_get")
+	aclLog.Describe("page", "The page of changes to show, the newest first", "2")
+	aclLog.AddExample("acl log contact_get --page 2")
+	aclList := irc.AddSubcommand(acls, "list", listAcls).AllowPrivate()
+	aclWhois := irc.AddSubcommand(acls, "whois", whoisAcl).AllowPrivate()
+	aclWhois.AddParameter("nick_or_chan", `\S+`).AddOption("channel", "c", `#\S+`, "").AddFlag("account", "a")
+	aclWhois.Describe("nick_or_chan", "The nickname or channel to check", "alice")
+	aclWhois.Describe("channel", "Check what the user can run in this channel", "#sre")
+	aclWhois.Describe("account", "Check a services account rather than an online nickname", "")
+	aclWhois.AddExample("acl whois alice --channel #sre")
+	irc.addAclCommand(acls, "get", "Gets the defined ACLs for a command", readAcl, showHelp)
+	groups := irc.AddCommandGroup("group")
+	irc.addGroupCommand(groups, "add", "Adds users or channels to a group", addGroupMembers, showHelp)
+	irc.addGroupCommand(groups, "remove", "Removes users or channels from a group", removeGroupMembers, showHelp)
+	irc.addGroupCommand(groups, "members", "Lists the members of a group", readGroup, showHelp)
+	irc.addSwitchCommand("disable", "Disables a command in a channel", disableCommand, showHelp)
+	irc.addSwitchCommand("enable", "Enables again a command disabled in a channel", enableCommand, showHelp)
+	modules := irc.AddCommand("modules", listModules).AllowPrivate()
 	pwd := irc.AddCommand("passwd", changePass).AddParameter("new_password", `\S+`).AllowPrivate()
 	if showHelp {
+		acls.SetHelp("Manages the ACLs of commands")
+		aclLog.SetHelp("Shows who changed the ACLs, and when")
+		aclList.SetHelp("Shows the ACLs of all commands")
+		aclWhois.SetHelp("Shows which commands a user or a channel can run")
+		groups.SetHelp("Manages groups of users, to be used in ACLs as @group")
+		modules.SetHelp("Lists the modules and the commands they add")
 		sing.SetHelp("Sings a nice tune.")
 		pwd.SetHelp("Changes the nickserv password.")
 	}
@@ -134,19 +209,39 @@ func (irc *IrcBot) AddBuiltins(showHelp bool) {
 	irc.AddCommand("quit", part).AllowPrivate()
 }
 
-func (irc *IrcBot) addAclCommand(name string, help string, callback CommandAction, showHelp bool) {
-	cmd := irc.AddCommand(name, callback).AllowPrivate()
+func (irc *IrcBot) addAclCommand(group *triggers.Command, name string, help string, callback CommandAction, showHelp bool) {
+	cmd := irc.AddSubcommand(group, name, callback).AllowPrivate()
+	if showHelp {
+		cmd.SetHelp(help)
+	}
+	cmd.AddParameter("command", `\w+`).Describe("command", "The ID of the command", "contact_get")
+	if name == "get" {
+		cmd.AddFlag("users-only", "u").AddFlag("channels-only", "c")
+		cmd.Describe("users-only", "Only show users", "").Describe("channels-only", "Only show channels", "")
+		return
+	}
+	cmd.AddListParameter("nick_or_chan", `\S+`).Describe("nick_or_chan", "One or more nicknames or channels", "#mychannel")
+	cmd.AddExample(fmt.Sprintf("acl %s contact_get jane bob #mychannel", name))
+	if name == "add" {
+		cmd.AddDurationOption("for", "").Describe("for", "Only grant access for this long", "8h")
+		cmd.AddExample("acl add contact_get alice --for 8h")
+	}
+}
+
+func (irc *IrcBot) addGroupCommand(group *triggers.Command, name string, help string, callback CommandAction, showHelp bool) {
+	cmd := irc.AddSubcommand(group, name, callback).AllowPrivate()
 	if showHelp {
 		cmd.SetHelp(help)
 	}
-	cmd.AddParameter("command", `\w+`)
-	if name != "acl_get" {
-		cmd.AddParameter("nick_or_chan", `\S+`)
+	cmd.AddParameter("group", `\w+`).Describe("group", "The name of the group", "sre")
+	if name != "members" {
+		cmd.AddListParameter("members", `[^@\s]\S*`).Describe("members", "One or more nicknames or channels", "jane")
+		cmd.AddExample(fmt.Sprintf("group %s sre jane bob", name))
 	}
 }
 
 type CommandAction func(
-	map[string]string,
+	triggers.Args,
 	*hbot.Message,
 	*IrcBot,
 ) bool
@@ -0,0 +1,63 @@
+package ircbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lavagetto/ircbot/acl"
+)
+
+// How often expired ACLs are removed.
+var sweepInterval = time.Minute
+
+// sweepAcls periodically removes the expired ACLs, and tells the admins
+// about them, until done is closed.
+func (irc *IrcBot) sweepAcls(done <-chan struct{}) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			expired, err := acl.SweepExpired(irc.DB())
+			if err != nil {
+				irc.Logger().Error("Problem removing expired ACLs:", "error", err.Error())
+				continue
+			}
+			for _, entry := range expired {
+				err := acl.Audit(acl.AuditEntry{Action: acl.ActionExpire, Command: entry.Command, Identifier: entry.Identifier}, irc.DB())
+				if err != nil {
+					irc.Logger().Error("Problem recording the ACL change:", "error", err.Error())
+				}
+				irc.notifyAdmins(fmt.Sprintf("The ACL for %s on %s has expired and was removed.", entry.Identifier, entry.Command))
+			}
+		}
+	}
+}
+
+// notifyAdmins sends a private message to the admins of the bot that
+// are online. Admins we can't find are left out, as whoever is using a
+// nick named like their account might not be them.
+func (irc *IrcBot) notifyAdmins(msg string) {
+	for _, admin := range irc.Config().Admins {
+		nicks := irc.bot.State.Nicks(admin)
+		if len(nicks) == 0 {
+			irc.Logger().Info("No known nick for the admin, not notifying", "account", admin, "message", msg)
+			continue
+		}
+		for _, nick := range nicks {
+			irc.Msg(nick, msg)
+		}
+	}
+}
+
+// remaining formats the time left until t, to the minute.
+func remaining(t time.Time) string {
+	left := time.Until(t)
+	if left < time.Minute {
+		return "less than a minute"
+	}
+	return strings.TrimSuffix(left.Round(time.Minute).String(), "0s")
+}
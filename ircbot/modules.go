@@ -0,0 +1,169 @@
+package ircbot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+	Modules.
+
+	A module bundles commands and triggers, along with the database tables
+	they need, so that they can be added to the bot in one go, and enabled
+	or disabled in the configuration:
+
+	"modules": {"contact": {"disabled": true}}
+
+	The migrations of a module are applied in order when it's registered,
+	and the ones already applied are recorded in the module_migrations table,
+	so each of them only runs once.
+*/
+
+// Module is a bundle of commands that can be registered with the bot.
+type Module interface {
+	// Name identifies the module in the configuration and in !modules.
+	Name() string
+	// Migrations returns the SQL statements that create and update the
+	// tables of the module. New statements must only ever be appended.
+	Migrations() []string
+	// Setup adds the commands and triggers of the module to the bot. config
+	// is the "config" section of the module settings, nil if there's none.
+	Setup(irc *IrcBot, config json.RawMessage) error
+	// Start is called right before the bot connects.
+	Start(irc *IrcBot) error
+	// Stop is called once the bot has disconnected.
+	Stop(irc *IrcBot) error
+}
+
+// BaseModule can be embedded in modules that don't need
+// migrations, or start and stop hooks.
+type BaseModule struct{}
+
+func (BaseModule) Migrations() []string    { return nil }
+func (BaseModule) Start(irc *IrcBot) error { return nil }
+func (BaseModule) Stop(irc *IrcBot) error  { return nil }
+
+// A module registered with the bot, and the commands it added.
+type registeredModule struct {
+	module   Module
+	enabled  bool
+	commands []string
+}
+
+// RegisterModule adds a module to the bot, unless it's disabled in the configuration.
+func (irc *IrcBot) RegisterModule(module Module) error {
+	name := module.Name()
+	for _, registered := range irc.modules {
+		if registered.module.Name() == name {
+			return fmt.Errorf("Cannot register module '%s' twice", name)
+		}
+	}
+	registered := &registeredModule{module: module, enabled: irc.Config().ModuleEnabled(name)}
+	if !registered.enabled {
+		irc.Logger().Info("Module disabled in the configuration", "module", name)
+		irc.modules = append(irc.modules, registered)
+		return nil
+	}
+	if err := irc.migrate(module); err != nil {
+		return fmt.Errorf("could not apply the migrations of module '%s': %w", name, err)
+	}
+	first := len(irc.ircCommands)
+	if err := module.Setup(irc, irc.Config().Modules[name].Config); err != nil {
+		return fmt.Errorf("could not set up module '%s': %w", name, err)
+	}
+	for _, cmd := range irc.ircCommands[first:] {
+		registered.commands = append(registered.commands, cmd.ID)
+	}
+	irc.modules = append(irc.modules, registered)
+	irc.Logger().Info("Module registered", "module", name, "commands", strings.Join(registered.commands, ","))
+	return nil
+}
+
+// migrate applies the migrations of a module that weren't applied yet.
+func (irc *IrcBot) migrate(module Module) error {
+	db := irc.DB()
+	applied := 0
+	err := db.QueryRow("SELECT version FROM module_migrations WHERE module = ?", module.Name()).Scan(&applied)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	migrations := module.Migrations()
+	if applied >= len(migrations) {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, migration := range migrations[applied:] {
+		if _, err := tx.Exec(migration); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		"INSERT OR REPLACE INTO module_migrations (module, version) VALUES (?, ?)",
+		module.Name(), len(migrations),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	irc.Logger().Info("Applied the migrations of a module", "module", module.Name(), "from", applied, "to", len(migrations))
+	return tx.Commit()
+}
+
+// AddTrigger adds an handler that is called for every message, rather than
+// for a command. It's meant for modules that need to react to events, like
+// a topic change.
+func (irc *IrcBot) AddTrigger(id string, handler triggers.TriggerFunc, help string) error {
+	return irc.registry.Register(id, handler, help, irc.DB(), irc.Config())
+}
+
+// startModules calls the start hook of the enabled modules.
+func (irc *IrcBot) startModules() {
+	for _, registered := range irc.modules {
+		if !registered.enabled {
+			continue
+		}
+		if err := registered.module.Start(irc); err != nil {
+			irc.Logger().Error("Could not start module:", "module", registered.module.Name(), "error", err.Error())
+		}
+	}
+}
+
+// stopModules calls the stop hook of the enabled modules.
+func (irc *IrcBot) stopModules() {
+	for _, registered := range irc.modules {
+		if !registered.enabled {
+			continue
+		}
+		if err := registered.module.Stop(irc); err != nil {
+			irc.Logger().Error("Could not stop module:", "module", registered.module.Name(), "error", err.Error())
+		}
+	}
+}
+
+func listModules(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	if len(irc.modules) == 0 {
+		irc.Reply(m, "No modules are registered.")
+		return true
+	}
+	irc.Reply(m, "Modules:")
+	for _, registered := range irc.modules {
+		switch {
+		case !registered.enabled:
+			irc.Reply(m, fmt.Sprintf("\t%s (disabled)", registered.module.Name()))
+		case len(registered.commands) == 0:
+			irc.Reply(m, fmt.Sprintf("\t%s (enabled)", registered.module.Name()))
+		default:
+			irc.Reply(m, fmt.Sprintf("\t%s (enabled): %s", registered.module.Name(), strings.Join(registered.commands, ", ")))
+		}
+	}
+	return true
+}
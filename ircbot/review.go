@@ -0,0 +1,141 @@
+package ircbot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+/*
+	Access reviews: all the ACLs at once, and the commands someone can run.
+*/
+
+// The kinds of entries in a dumped ACL, in the order they're listed.
+var aclKinds = []struct {
+	key   string
+	label string
+}{
+	{"nicks", "users"},
+	{"masks", "hostmasks"},
+	{"statuses", "channel status"},
+	{"scoped", "users in channels"},
+	{"groups", "groups"},
+	{"channels", "channels"},
+}
+
+// summarizeAcl describes an ACL in a single line. Admins are left out,
+// as they can run any command.
+func (irc *IrcBot) summarizeAcl(data map[string][]string) string {
+	admins := make(map[string]bool)
+	for _, admin := range irc.Config().Admins {
+		admins[admin] = true
+	}
+	parts := make([]string, 0)
+	for _, prefix := range []string{"", "denied_"} {
+		for _, kind := range aclKinds {
+			items := make([]string, 0)
+			for _, item := range data[prefix+kind.key] {
+				if prefix == "" && kind.key == "nicks" && admins[item] {
+					continue
+				}
+				items = append(items, item)
+			}
+			if len(items) > 0 {
+				label := kind.label
+				if prefix != "" {
+					label = "denied " + label
+				}
+				parts = append(parts, fmt.Sprintf("%s: %s", label, strings.Join(items, ", ")))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "only admins"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func listAcls(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	irc.Reply(m, fmt.Sprintf("Admins, allowed to run any command: %s", strings.Join(irc.Config().Admins, ", ")))
+	for _, command := range irc.registry.CommandIDs() {
+		myAcl, err := acl.GetACL(command, irc.DB(), irc.Config())
+		if err != nil {
+			irc.Reply(m, fmt.Sprintf("%s: could not fetch the ACL: %s", command, err.Error()))
+			continue
+		}
+		irc.Reply(m, fmt.Sprintf("%s: %s", command, irc.summarizeAcl(myAcl.Dump())))
+	}
+	return true
+}
+
+// whoisAcl lists the commands a user or a channel can run. Users are
+// checked as if they sent a private message, or a message to a channel
+// if --channel is passed. With --account, the ACLs of a services account
+// are checked, even if nobody is using it right now. Hostmask rules can't
+// be checked for other users, as we don't know their hostmask.
+func whoisAcl(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	who := args["nick_or_chan"]
+	isChannel := strings.HasPrefix(who, "#")
+	byAccount := args.Bool("account") && !isChannel
+	account := ""
+	switch {
+	case byAccount:
+		account = who
+	case !isChannel:
+		var ok bool
+		account, ok = irc.bot.State.Account(irc.bot.Irc, who)
+		if !ok {
+			irc.Reply(m, fmt.Sprintf("Sorry, I couldn't find out the services account of %s. Use --account to check an account instead.", who))
+			return true
+		}
+	}
+	allowed := irc.runnableBy(account, irc.forgeMessage(who, args["channel"]))
+	switch {
+	case isChannel, byAccount:
+	case account == "":
+		irc.Reply(m, fmt.Sprintf("%s is not identified with NickServ, or is not online. Use --account to check an account instead.", who))
+	default:
+		irc.Reply(m, fmt.Sprintf("%s is identified as %s.", who, account))
+	}
+	if len(allowed) == 0 {
+		irc.Reply(m, fmt.Sprintf("%s can't run any command.", who))
+		return true
+	}
+	irc.Reply(m, fmt.Sprintf("%s can run: %s", who, strings.Join(allowed, ", ")))
+	return true
+}
+
+// forgeMessage forges the message we'd get from a user, in private or in
+// a channel if one is given, or from nobody in particular in a channel.
+func (irc *IrcBot) forgeMessage(who string, channel string) *hbot.Message {
+	forged := &hbot.Message{Message: &sx.Message{Command: sx.PRIVMSG, Prefix: &sx.Prefix{}}, To: irc.Config().NickName}
+	if strings.HasPrefix(who, "#") {
+		forged.To = who
+		return forged
+	}
+	forged.Prefix.Name = who
+	if channel != "" {
+		forged.To = channel
+	}
+	return forged
+}
+
+// runnableBy returns the commands the ACLs allow to run with a message.
+func (irc *IrcBot) runnableBy(account string, m *hbot.Message) []string {
+	allowed := make([]string, 0)
+	for _, command := range irc.registry.CommandIDs() {
+		myAcl, err := acl.GetACL(command, irc.DB(), irc.Config())
+		if err != nil {
+			irc.Logger().Error("Couldn't fetch the ACLs", "error", err.Error())
+			continue
+		}
+		if myAcl.IsAllowed(account, m, irc.bot.State) {
+			allowed = append(allowed, command)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,91 @@
+package ircbot
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/bot"
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+	sx "gopkg.in/sorcix/irc.v2"
+)
+
+// getIrcBot returns a bot that is not connected, with an in-memory
+// database with the bot schema loaded.
+func getIrcBot(t *testing.T) *IrcBot {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The database only lives as long as its connection, so keep just one.
+	db.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	irc, err := hbot.NewBot("localhost:6667", "IrcBot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &bot.Configuration{NickName: "IrcBot", Admins: []string{"admin"}}
+	return &IrcBot{
+		conf:     conf,
+		bot:      &bot.Bot{Irc: irc, DB: db, State: bot.NewState()},
+		registry: triggers.NewRegistry(),
+	}
+}
+
+func TestWhoisChannel(t *testing.T) {
+	irc := getIrcBot(t)
+	for _, id := range []string{"sing", "topic"} {
+		if err := irc.registry.RegisterCommand(irc.AddCommand(id, sing)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for identifier, command := range map[string]string{"@op:#sre": "sing", "#sre": "topic"} {
+		if err := acl.SaveACL(command, identifier, irc.DB()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	irc.bot.State.Handle(irc.bot.Irc, hbot.ParseMessage(":server 353 IrcBot = #sre :@jane bob"))
+	testCases := []struct {
+		who      string
+		channel  string
+		expected []string
+	}{
+		// A channel doesn't hold any status.
+		{"#sre", "", []string{"topic"}},
+		{"jane", "#sre", []string{"sing", "topic"}},
+		// Being an op in #sre is enough, wherever the command is run.
+		{"jane", "", []string{"sing"}},
+		{"bob", "#sre", []string{"topic"}},
+	}
+	for _, tc := range testCases {
+		allowed := irc.runnableBy("", irc.forgeMessage(tc.who, tc.channel))
+		if !reflect.DeepEqual(allowed, tc.expected) {
+			t.Errorf("%s in %q: expected %v, got %v", tc.who, tc.channel, tc.expected, allowed)
+		}
+	}
+}
+
+func TestWhoisAccount(t *testing.T) {
+	irc := getIrcBot(t)
+	if err := irc.registry.RegisterCommand(irc.AddCommand("sing", sing)); err != nil {
+		t.Fatal(err)
+	}
+	m := &hbot.Message{Message: &sx.Message{Command: sx.PRIVMSG, Prefix: &sx.Prefix{Name: "admin"}}, To: "IrcBot"}
+	// alice is not online, so a WHOIS would time out: with --account,
+	// they are not looked up.
+	start := time.Now()
+	whoisAcl(triggers.Args{"nick_or_chan": "alice", "account": "true"}, m, irc)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Checking an account should not need a WHOIS, took %s", elapsed)
+	}
+}
@@ -0,0 +1,76 @@
+package ircbot
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lavagetto/ircbot/acl"
+	"github.com/lavagetto/ircbot/triggers"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// The channel a command is disabled or enabled in defaults
+// to the one the message was sent to.
+func channelFromMsg(m *hbot.Message) string {
+	if strings.HasPrefix(m.To, "#") {
+		return m.To
+	}
+	return ""
+}
+
+func processSwitchParams(args triggers.Args, m *hbot.Message, irc *IrcBot) (string, string, bool) {
+	channel := args["channel"]
+	if !strings.HasPrefix(channel, "#") {
+		irc.Reply(m, "Please tell me which channel, like #mychannel.")
+		return "", "", false
+	}
+	command, ok := irc.resolveCommand(args["command"], m)
+	return command, channel, ok
+}
+
+func disableCommand(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	command, channel, ok := processSwitchParams(args, m, irc)
+	if !ok {
+		return false
+	}
+	if acl.IsDisabled(command, channel, irc.DB()) {
+		irc.Reply(m, fmt.Sprintf("%s is already disabled in %s.", command, channel))
+		return false
+	}
+	return switchCommand(m, irc, command, channel, acl.ActionDisable, acl.DisableCommand)
+}
+
+func enableCommand(args triggers.Args, m *hbot.Message, irc *IrcBot) bool {
+	command, channel, ok := processSwitchParams(args, m, irc)
+	if !ok {
+		return false
+	}
+	if !acl.IsDisabled(command, channel, irc.DB()) {
+		irc.Reply(m, fmt.Sprintf("%s is not disabled in %s.", command, channel))
+		return false
+	}
+	return switchCommand(m, irc, command, channel, acl.ActionEnable, acl.EnableCommand)
+}
+
+func switchCommand(m *hbot.Message, irc *IrcBot, command string, channel string, action string, save func(string, string, *sql.DB) error) bool {
+	if err := save(command, channel, irc.DB()); err != nil {
+		irc.Logger().Error("Problem switching the command:", "error", err.Error(), "action", action)
+		irc.Reply(m, fmt.Sprintf("Couldn't %s %s in %s.", action, command, channel))
+		return false
+	}
+	irc.audit(m, action, command, channel)
+	irc.Reply(m, fmt.Sprintf("%s was %sd in %s.", command, action, channel))
+	return true
+}
+
+func (irc *IrcBot) addSwitchCommand(name string, help string, callback CommandAction, showHelp bool) {
+	cmd := irc.AddCommand(name, callback).AllowChannel().AllowPrivate()
+	if showHelp {
+		cmd.SetHelp(help)
+	}
+	cmd.AddParameter("command", `\w+`).AddParameterWithDefaultCb("channel", `#\S+`, channelFromMsg)
+	cmd.Describe("command", "The ID of the command, or of a group of subcommands", "sing")
+	cmd.Describe("channel", "The channel, by default the one you're in", "#mychannel")
+	cmd.AddExample(fmt.Sprintf("%s sing #mychannel", name))
+}
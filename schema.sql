@@ -1,3 +1,6 @@
-CREATE TABLE contacts (`name` VARCHAR(256) PRIMARY KEY, `phone` VARCHAR(256), `email` VARCHAR(256));
 CREATE TABLE topics (`channel` VARCHAR(256) PRIMARY KEY, `topic` TEXT);
-CREATE TABLE acls (`command` VARCHAR(256), `identifier` VARCHAR(256), PRIMARY KEY (`command`, `identifier`));
+CREATE TABLE acls (`command` VARCHAR(256), `identifier` VARCHAR(256), `deny` BOOLEAN NOT NULL DEFAULT 0, `expires_at` INTEGER, `source` VARCHAR(16) NOT NULL DEFAULT 'runtime', PRIMARY KEY (`command`, `identifier`));
+CREATE TABLE acl_groups (`name` VARCHAR(256), `member` VARCHAR(256), PRIMARY KEY (`name`, `member`));
+CREATE TABLE acl_audit (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `timestamp` INTEGER, `actor` VARCHAR(256), `action` VARCHAR(32), `command` VARCHAR(256), `identifier` VARCHAR(256), `channel` VARCHAR(256));
+CREATE TABLE module_migrations (`module` VARCHAR(256) PRIMARY KEY, `version` INTEGER NOT NULL);
+CREATE TABLE disabled_commands (`channel` VARCHAR(256), `command` VARCHAR(256), PRIMARY KEY (`channel`, `command`));
@@ -16,7 +16,7 @@ import (
 Commands section
 */
 type CommandClosure func(
-	map[string]string,
+	Args,
 	*hbot.Bot,
 	*hbot.Message,
 	*bot.Configuration,
@@ -30,12 +30,30 @@ type argsCallback func(
 type CommandArgument struct {
 	validator       *regexp.Regexp
 	defaultCallback argsCallback
+	// If true, the argument will swallow the rest of the line
+	trailing bool
+	// If true, the argument accepts one or more values
+	variadic bool
+	// The type of the argument, for typed parameters
+	kind      string
+	converter argsConverter
+	// For options, the short name and whether it's a flag
+	short string
+	flag  bool
+	// Shown in the help of the command
+	description string
+	example     string
 }
 
 func (c *CommandArgument) SetValidator(reg string) {
 	c.validator = regexp.MustCompile(reg)
 }
 
+// anchored makes a validation regexp only match whole values.
+func anchored(regex string) string {
+	return fmt.Sprintf("^(?:%s)$", regex)
+}
+
 // Set default value
 func (c *CommandArgument) Default(value string) {
 	c.defaultCallback = func(*hbot.Message) string {
@@ -44,13 +62,38 @@ func (c *CommandArgument) Default(value string) {
 }
 
 func (c *CommandArgument) Validate(value string) error {
-	if c.validator.FindStringIndex(value) != nil {
+	if c.validator == nil || c.validator.FindStringIndex(value) != nil {
 		return nil
 	}
 
 	return fmt.Errorf("the value %s doesn't match the regexp %s", value, c.validator.String())
 }
 
+// Describe sets the description of the argument, shown in the help of the command.
+func (c *CommandArgument) Describe(description string) *CommandArgument {
+	c.description = description
+	return c
+}
+
+// SetExample sets an example value for the argument, shown in the help of the command.
+func (c *CommandArgument) SetExample(example string) *CommandArgument {
+	c.example = example
+	return c
+}
+
+// IsOptional tells if the argument has a default value.
+func (c *CommandArgument) IsOptional() bool {
+	return c.defaultCallback != nil
+}
+
+// Convert transforms the value of a typed argument to its canonical form.
+func (c *CommandArgument) Convert(value string) (string, error) {
+	if c.converter == nil {
+		return value, nil
+	}
+	return c.converter(value)
+}
+
 func (c *CommandArgument) Get(value string, m *hbot.Message) string {
 	if value != "" {
 		return value
@@ -73,8 +116,22 @@ type Command struct {
 	Action          CommandClosure
 	Db              *sql.DB
 	Configuration   *bot.Configuration
+	State           *bot.State
 	parameters      map[string]*CommandArgument
 	paramOder       []string
+	options         map[string]*CommandArgument
+	optionOrder     []string
+	// Subcommands, and for subcommands the parent command
+	// and the name they're invoked with.
+	subcommands []*Command
+	parent      *Command
+	name        string
+	// Alternative names the command can be invoked with.
+	aliases []string
+	// Example invocations, without the command prefix.
+	examples []string
+	// Everyone can run the command, whatever its ACL says.
+	everyone bool
 }
 
 func (cmd *Command) InitParams() {
@@ -84,23 +141,31 @@ func (cmd *Command) InitParams() {
 	if cmd.paramOder == nil {
 		cmd.paramOder = make([]string, 0)
 	}
+	if cmd.options == nil {
+		cmd.options = make(map[string]*CommandArgument)
+	}
 }
 
 func (cmd *Command) addParameter(name string, c *CommandArgument) {
+	if cmd.hasFinalParameter() {
+		panic("A command can't have more parameters after a trailing or list one")
+	}
 	cmd.parameters[name] = c
 	cmd.paramOder = append(cmd.paramOder, name)
 }
 
+// AddParameter adds a required parameter. The whole value passed
+// must match the regexp, as for all the parameters and options.
 func (cmd *Command) AddParameter(name string, regex string) *Command {
 	c := &CommandArgument{}
-	c.SetValidator(regex)
+	c.SetValidator(anchored(regex))
 	cmd.addParameter(name, c)
 	return cmd
 }
 
 func (cmd *Command) AddParameterWithDefault(name string, regex string, defaultValue string) *Command {
 	c := &CommandArgument{}
-	c.SetValidator(fmt.Sprintf("(%s)?", regex))
+	c.SetValidator(anchored(regex))
 	c.Default(defaultValue)
 	cmd.addParameter(name, c)
 	return cmd
@@ -108,12 +173,41 @@ func (cmd *Command) AddParameterWithDefault(name string, regex string, defaultVa
 
 func (cmd *Command) AddParameterWithDefaultCb(name string, regex string, defaultCb argsCallback) *Command {
 	c := &CommandArgument{}
-	c.SetValidator(fmt.Sprintf("(%s)?", regex))
+	c.SetValidator(anchored(regex))
 	c.defaultCallback = defaultCb
 	cmd.addParameter(name, c)
 	return cmd
 }
 
+// AddTrailingParameter adds a parameter that will take the rest of the line
+// verbatim, spaces included. It must be the last parameter of the command.
+func (cmd *Command) AddTrailingParameter(name string, regex string) *Command {
+	c := &CommandArgument{trailing: true}
+	c.SetValidator(anchored(regex))
+	cmd.addParameter(name, c)
+	return cmd
+}
+
+// AddListParameter adds a parameter that accepts one or more values,
+// each one validated against the regexp. It must be the last parameter
+// of the command. Use Args.List to get the values.
+func (cmd *Command) AddListParameter(name string, regex string) *Command {
+	c := &CommandArgument{variadic: true}
+	c.SetValidator(anchored(regex))
+	cmd.addParameter(name, c)
+	return cmd
+}
+
+// hasFinalParameter tells if the last parameter takes all the remaining arguments.
+func (cmd *Command) hasFinalParameter() bool {
+	numParams := len(cmd.paramOder)
+	if numParams == 0 {
+		return false
+	}
+	last := cmd.parameters[cmd.paramOder[numParams-1]]
+	return last.trailing || last.variadic
+}
+
 func (cmd *Command) Parameter(name string) *CommandArgument {
 	if _, ok := cmd.parameters[name]; !ok {
 		cmd.addParameter(name, &CommandArgument{})
@@ -134,6 +228,58 @@ func (cmd *Command) AllowChannel() *Command {
 	return cmd
 }
 
+// AllowEveryone lets everyone run the command, without checking its ACL.
+func (cmd *Command) AllowEveryone() *Command {
+	cmd.everyone = true
+	return cmd
+}
+
+// AddAlias adds an alternative name the command can be invoked with.
+// ACLs are always checked against the command ID.
+func (cmd *Command) AddAlias(alias string) *Command {
+	cmd.aliases = append(cmd.aliases, alias)
+	return cmd
+}
+
+// Aliases returns the alternative names of the command.
+func (cmd *Command) Aliases() []string {
+	return cmd.aliases
+}
+
+// isCalled checks if the command is invoked with the given word.
+func (cmd *Command) isCalled(word string) bool {
+	if word == cmd.ID {
+		return true
+	}
+	for _, alias := range cmd.aliases {
+		if word == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe sets the description and an example value of a parameter or an option.
+// The example can be empty.
+func (cmd *Command) Describe(name string, description string, example string) *Command {
+	c, ok := cmd.parameters[name]
+	if !ok {
+		c, ok = cmd.options[name]
+	}
+	if !ok {
+		panic(fmt.Sprintf("Can't describe %s, it's neither a parameter nor an option", name))
+	}
+	c.Describe(description).SetExample(example)
+	return cmd
+}
+
+// AddExample adds an example invocation of the command, without the
+// command prefix, e.g. "contact add jane +3912345678 jane@example.org".
+func (cmd *Command) AddExample(invocation string) *Command {
+	cmd.examples = append(cmd.examples, invocation)
+	return cmd
+}
+
 func (cmd *Command) SetHelp(msg string) *Command {
 	cmd.HelpMsg = msg
 	return cmd
@@ -151,10 +297,12 @@ func (cmd *Command) Arguments(argRegexp string) *Command {
 	return cmd
 }
 
-// Checks if we should act on the event.
-func (cmd Command) isCommand(bot *hbot.Bot, m *hbot.Message) bool {
+// Checks if we should act on the event. It returns the command or subcommand
+// that should handle the message, and the number of words of the message
+// that make up the invocation of the command.
+func (cmd *Command) isCommand(bot *hbot.Bot, m *hbot.Message) (*Command, int) {
 	if cmd.ID == "" {
-		return false
+		return nil, 0
 	}
 	// The action is triggered to private messages for !command
 	// or public messages for !command
@@ -162,58 +310,201 @@ func (cmd Command) isCommand(bot *hbot.Bot, m *hbot.Message) bool {
 	// Please note that PRIVMSG in hellabot conventions is any message received
 	// by the bot, either public or private.
 	if m.Command != "PRIVMSG" {
-		return false
+		return nil, 0
+	}
+	line, ok := cmd.commandLine(m)
+	if !ok {
+		return nil, 0
+	}
+	t := newTokenizer(line)
+	maybeCommand, ok, err := t.next()
+	if !ok || err != nil {
+		return nil, 0
+	}
+	target, words := cmd.lookup(maybeCommand, t)
+	if target == nil || !target.allowedIn(m) {
+		return nil, 0
+	}
+	return target, words
+}
+
+// prefix returns the command prefix in use where the message was sent.
+func (cmd Command) prefix(m *hbot.Message) string {
+	return prefixFor(m, cmd.Configuration)
+}
+
+func (cmd Command) commandLine(m *hbot.Message) (string, bool) {
+	return commandLine(m, cmd.Configuration)
+}
+
+func prefixFor(m *hbot.Message, conf *bot.Configuration) string {
+	channel := ""
+	if strings.HasPrefix(m.To, "#") {
+		channel = m.To
+	}
+	if conf == nil {
+		return "!"
+	}
+	return conf.PrefixFor(channel)
+}
+
+// commandLine returns the content of the message without the command prefix,
+// or without the nickname of the bot if the message is addressed to it, like
+// "IrcBot: help". It returns false if the message is not a command invocation.
+func commandLine(m *hbot.Message, conf *bot.Configuration) (string, bool) {
+	line := strings.TrimSpace(m.Content)
+	prefix := prefixFor(m, conf)
+	if conf != nil {
+		nick := conf.NickName
+		if nick != "" && len(line) > len(nick) && strings.EqualFold(line[:len(nick)], nick) {
+			rest := line[len(nick):]
+			if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, ",") {
+				// The prefix is optional when addressing the bot.
+				return strings.TrimPrefix(strings.TrimSpace(rest[1:]), prefix), true
+			}
+		}
+	}
+	if !strings.HasPrefix(line, prefix) {
+		return "", false
 	}
-	maybeCommand := strings.Fields(m.Content)[0]
-	if maybeCommand != "!"+cmd.ID {
+	return strings.TrimPrefix(line, prefix), true
+}
+
+// allowedIn checks if the command can be invoked where the message was sent.
+func (cmd *Command) allowedIn(m *hbot.Message) bool {
+	// A command that is just a group of subcommands can be invoked
+	// wherever one of its subcommands can.
+	if cmd.isGroup() {
+		for _, sub := range cmd.subcommands {
+			if sub.allowedIn(m) {
+				return true
+			}
+		}
 		return false
 	}
 	// Do not accept commands in a channel if they're not public
-	if !cmd.public && strings.HasPrefix(m.To, "#") {
-		return false
+	if strings.HasPrefix(m.To, "#") {
+		return cmd.public
 	}
 	// Do not accept private commands if they're not private
-	if !cmd.privmsg && !strings.HasPrefix(m.To, "#") {
-		return false
-	}
-	return true
+	return cmd.privmsg
 }
 
-// Checks if the sender/channel allow the action.
-func (cmd Command) checkAcl(irc *hbot.Bot, m *hbot.Message) bool {
+// isAllowed tells if the ACL of the command allows the sender of a message,
+// identified to account, to run it.
+// The ACL is looked up by ID, whatever name the command was invoked with.
+func (cmd *Command) isAllowed(account string, m *hbot.Message) bool {
+	if cmd.everyone {
+		return true
+	}
 	acl, err := acl.GetACL(cmd.ID, cmd.Db, cmd.Configuration)
 	if err != nil {
 		// We log the issue, but we don't stop admins from being able to perform commands.
 		log.Error("Couldn't fetch the ACLs", "error", err.Error())
 	}
-	if !acl.IsAllowed(m) {
-		irc.Reply(m, "You're not allowed to perform this action.")
+	return acl.IsAllowed(account, m, cmd.State)
+}
+
+// visibleTo tells if the sender of a message, identified to account, can run
+// the command where the message was sent. A group of subcommands is visible
+// if any of its subcommands is.
+func (cmd *Command) visibleTo(account string, m *hbot.Message) bool {
+	if cmd.isGroup() {
+		for _, sub := range cmd.subcommands {
+			if sub.visibleTo(account, m) {
+				return true
+			}
+		}
 		return false
-	} else {
+	}
+	return cmd.allowedIn(m) && !cmd.disabledIn(m) && cmd.isAllowed(account, m)
+}
+
+// disabledIn tells if the command, or the group it belongs to, was
+// disabled in the channel the message was sent to.
+func (cmd *Command) disabledIn(m *hbot.Message) bool {
+	if !strings.HasPrefix(m.To, "#") || cmd.Db == nil {
+		return false
+	}
+	for c := cmd; c != nil; c = c.parent {
+		if acl.IsDisabled(c.ID, m.To, cmd.Db) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the sender/channel allow the action.
+func (cmd Command) checkAcl(irc *hbot.Bot, m *hbot.Message) bool {
+	if cmd.everyone {
+		return true
+	}
+	account, ok := cmd.State.Account(irc, m.Name)
+	if !ok {
+		irc.Reply(m, "Sorry, I couldn't verify your services account, please try again.")
+		return false
+	}
+	if cmd.isAllowed(account, m) {
 		return true
 	}
+	if account == "" {
+		irc.Reply(m, "You need to identify with NickServ to perform this action.")
+	} else {
+		irc.Reply(m, "You're not allowed to perform this action.")
+	}
+	return false
 
 }
 
-func (cmd Command) doAction(irc *hbot.Bot, m *hbot.Message) bool {
-	args, err := cmd.parseMessage(m)
+func (cmd Command) doAction(irc *hbot.Bot, m *hbot.Message, words int) bool {
+	args, err := cmd.parseMessage(m, words)
+	// Never call the action with partial arguments.
 	if err != nil {
-		irc.Reply(m, err.Error())
+		irc.Reply(m, fmt.Sprintf("Sorry, %s.", err.Error()))
+		irc.Reply(m, fmt.Sprintf("Usage: %s", cmd.usage(cmd.prefix(m))))
+		return true
 	}
 	return cmd.Action(args, irc, m, cmd.Configuration, cmd.Db)
 }
 
-func (cmd Command) parseMessage(m *hbot.Message) (map[string]string, error) {
-	args := make(map[string]string)
-	rawArgs := strings.Fields(m.Content)[1:]
-	numRawArgs := len(rawArgs)
+// UsageError is the error returned when a command is not invoked correctly.
+type UsageError struct {
+	// The parameter or option the error refers to, if any
+	Parameter string
+	// The value that was passed, if any
+	Value string
+	// What went wrong, e.g. "expected an integer"
+	Reason string
+}
+
+func (e *UsageError) Error() string {
+	switch {
+	case e.Parameter == "":
+		return e.Reason
+	case e.Value == "":
+		return fmt.Sprintf("%s for %s", e.Reason, e.Parameter)
+	default:
+		return fmt.Sprintf("invalid value %q for %s: %s", e.Value, e.Parameter, e.Reason)
+	}
+}
+
+func (cmd Command) parseMessage(m *hbot.Message, words int) (Args, error) {
+	args := make(Args)
+	line, _ := cmd.commandLine(m)
+	t := newTokenizer(line)
+	// Skip the command itself, and the subcommands if any.
+	for i := 0; i < words; i++ {
+		if _, _, err := t.next(); err != nil {
+			return args, &UsageError{Reason: err.Error()}
+		}
+	}
 	if cmd.ArgumentsRegexp != nil {
 		arg_names := cmd.ArgumentsRegexp.SubexpNames()
-		argsStr := strings.Join(rawArgs, " ")
+		argsStr := strings.Join(strings.Fields(t.rest()), " ")
 		// Validate the content of the string
 		matches := cmd.ArgumentsRegexp.FindStringSubmatch(argsStr)
 		if matches == nil {
-			return args, fmt.Errorf("the command is not properly formatted")
+			return args, &UsageError{Reason: "the command is not properly formatted"}
 		}
 		for i, match := range matches[1:] {
 			name := arg_names[i]
@@ -221,34 +512,158 @@ func (cmd Command) parseMessage(m *hbot.Message) (map[string]string, error) {
 		}
 		return args, nil
 	}
-	for idx, param := range cmd.paramOder {
+	rawValues, err := cmd.splitArguments(t)
+	if err != nil {
+		return args, err
+	}
+	for _, param := range cmd.paramOder {
 		c := cmd.Parameter(param)
-		var value string
-		// A value was provided
-		if numRawArgs > idx {
-			err := c.Validate(rawArgs[idx])
-			if err != nil {
-				return args, err
-			}
-			value = c.Get(rawArgs[idx], m)
-		} else {
-			value = c.Get("", m)
+		valueFunc := cmd.argumentValue
+		if c.variadic {
+			valueFunc = cmd.listValue
 		}
-		// If no value was provided, and no default was provided, return an error
-		if value == "" {
-			return args, fmt.Errorf("no value provided for parameter %s and no default available", param)
+		value, err := valueFunc(param, c, rawValues[param], m, true)
+		if err != nil {
+			return args, err
 		}
 		args[param] = value
 	}
+	for _, name := range cmd.optionOrder {
+		value, err := cmd.argumentValue(name, cmd.options[name], rawValues[name], m, false)
+		if err != nil {
+			return args, err
+		}
+		args[name] = value
+	}
 	return args, nil
 }
 
+// splitArguments assigns the arguments in the message to the positional
+// parameters and the options of the command.
+func (cmd Command) splitArguments(t *tokenizer) (map[string]string, error) {
+	rawValues := make(map[string]string)
+	position := 0
+	optionsDone := false
+	for {
+		var param *CommandArgument
+		if position < len(cmd.paramOder) {
+			param = cmd.Parameter(cmd.paramOder[position])
+		}
+		pos := t.pos
+		token, ok, err := t.next()
+		if param != nil && param.trailing {
+			// Trailing parameters take the rest of the line as-is,
+			// so quotes in free text don't need to be balanced.
+			// Options can still be passed before the free text.
+			if optionsDone || err != nil || !ok || !isOption(token) {
+				t.pos = pos
+				rawValues[cmd.paramOder[position]] = t.rest()
+				return rawValues, nil
+			}
+		}
+		if err != nil {
+			return rawValues, &UsageError{Reason: err.Error()}
+		}
+		if !ok {
+			return rawValues, nil
+		}
+		if !optionsDone && isOption(token) {
+			if token == "--" {
+				optionsDone = true
+				continue
+			}
+			if err := cmd.parseOption(token, t, rawValues); err != nil {
+				return rawValues, err
+			}
+			continue
+		}
+		// Additional arguments are ignored.
+		if param != nil && param.variadic {
+			name := cmd.paramOder[position]
+			rawValues[name] = strings.TrimLeft(rawValues[name]+" "+quote(token), " ")
+		} else if param != nil {
+			rawValues[cmd.paramOder[position]] = token
+			position++
+		}
+	}
+}
+
+// argumentValue validates the raw value of an argument, or gets its default
+// if no value was provided, and converts it if it's a typed argument.
+// Options are not required to have a value.
+func (cmd Command) argumentValue(name string, c *CommandArgument, raw string, m *hbot.Message, required bool) (string, error) {
+	// A value was provided
+	if raw != "" {
+		err := c.Validate(raw)
+		if err != nil {
+			return "", &UsageError{Parameter: name, Value: raw, Reason: fmt.Sprintf("expected a value matching %s", c.validator)}
+		}
+	}
+	value := c.Get(raw, m)
+	if value == "" && !required {
+		return "", nil
+	}
+	// If no value was provided, and no default was provided, return an error
+	if value == "" {
+		return "", &UsageError{Parameter: name, Reason: "missing value"}
+	}
+	converted, err := c.Convert(value)
+	if err != nil {
+		return "", &UsageError{Parameter: name, Value: value, Reason: err.Error()}
+	}
+	value = converted
+	return value, nil
+}
+
+// listValue validates and converts each of the values of a list argument.
+func (cmd Command) listValue(name string, c *CommandArgument, raw string, m *hbot.Message, required bool) (string, error) {
+	if raw == "" {
+		return cmd.argumentValue(name, c, raw, m, required)
+	}
+	values, err := tokenize(raw)
+	if err != nil {
+		return "", &UsageError{Reason: err.Error()}
+	}
+	for i, value := range values {
+		values[i], err = cmd.argumentValue(name, c, value, m, required)
+		if err != nil {
+			return "", err
+		}
+		values[i] = quote(values[i])
+	}
+	return strings.Join(values, " "), nil
+}
+
 func (cmd Command) Help() string {
+	prefix := "!"
+	if cmd.Configuration != nil {
+		prefix = cmd.Configuration.PrefixFor("")
+	}
+	return cmd.helpWithPrefix(prefix, nil)
+}
+
+// helpWithPrefix renders the help message using the given command prefix.
+// Groups only list the subcommands visible passes, or all of them if it's nil.
+func (cmd Command) helpWithPrefix(prefix string, visible func(*Command) bool) string {
 	// don't show help if none was provided.
 	if cmd.HelpMsg == "" {
 		return ""
 	}
-	parameters := []string{fmt.Sprintf("!%s", cmd.ID)}
+	if cmd.isGroup() {
+		names := make([]string, 0, len(cmd.subcommands))
+		for _, sub := range cmd.subcommands {
+			if visible == nil || visible(sub) {
+				names = append(names, sub.name)
+			}
+		}
+		return fmt.Sprintf("%s. Subcommands: %s", cmd.HelpMsg, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("%s. Format: %s", cmd.HelpMsg, cmd.usage(prefix))
+}
+
+// usage returns the syntax of the command, e.g. "!contact add <name> <phone>".
+func (cmd Command) usage(prefix string) string {
+	parameters := []string{cmd.invocation(prefix)}
 	if cmd.ArgumentsRegexp != nil {
 		for i, parameter := range cmd.ArgumentsRegexp.SubexpNames()[1:] {
 			if parameter == "" {
@@ -258,16 +673,43 @@ func (cmd Command) Help() string {
 		}
 	}
 	for _, parameter := range cmd.paramOder {
-		parameters = append(parameters, fmt.Sprintf("<%s>", parameter))
+		c := cmd.parameters[parameter]
+		name := parameter
+		if c.kind != "" {
+			name = fmt.Sprintf("%s:%s", parameter, c.kind)
+		}
+		if c.trailing {
+			name += "..."
+		}
+		placeholder := fmt.Sprintf("<%s>", name)
+		if c.variadic {
+			placeholder += "..."
+		}
+		if c.IsOptional() {
+			parameters = append(parameters, fmt.Sprintf("[%s]", placeholder))
+		} else {
+			parameters = append(parameters, placeholder)
+		}
 	}
-	return fmt.Sprintf("%s. Format: %s", cmd.HelpMsg, strings.Join(parameters, " "))
-
+	for _, name := range cmd.optionOrder {
+		parameters = append(parameters, cmd.options[name].optionHelp(name))
+	}
+	return strings.Join(parameters, " ")
 }
 
 func (cmd Command) Handle(irc *hbot.Bot, m *hbot.Message) bool {
 	//log.Info("Handling message", "command", m.Command, "to", m.To, "content", m.Content)
-	if cmd.isCommand(irc, m) && cmd.checkAcl(irc, m) {
-		return cmd.doAction(irc, m)
+	target, words := cmd.isCommand(irc, m)
+	if target == nil || target.disabledIn(m) {
+		return false
+	}
+	// A group invoked without a valid subcommand.
+	if target.isGroup() {
+		irc.Reply(m, fmt.Sprintf("Usage: %s <%s>", target.invocation(cmd.prefix(m)), strings.Join(target.subcommandNames(m), "|")))
+		return true
+	}
+	if target.checkAcl(irc, m) {
+		return target.doAction(irc, m, words)
 	} else {
 		return false
 	}
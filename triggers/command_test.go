@@ -2,9 +2,14 @@ package triggers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/lavagetto/ircbot/acl"
 	"github.com/lavagetto/ircbot/bot"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -18,6 +23,16 @@ func forgeMsg(content string) *hbot.Message {
 	return &hbot.Message{Message: &m, Content: content, To: "ircbot"}
 }
 
+// getBot returns a bot that is not connected, but can buffer
+// a few replies without blocking.
+func getBot() *hbot.Bot {
+	irc, err := hbot.NewBot("localhost:6667", "IrcBot")
+	if err != nil {
+		panic(err)
+	}
+	return irc
+}
+
 func getsql() *sql.DB {
 	db, err := sql.Open("sqlite3", "test.db")
 	if err != nil {
@@ -25,6 +40,26 @@ func getsql() *sql.DB {
 	}
 	return db
 }
+
+// getMemorySql returns a fresh in-memory database with the schema of the
+// bot, for tests that need the tables to be there.
+func getMemorySql(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A single connection, or the schema would only exist on one of them.
+	db.SetMaxOpenConns(1)
+	schema, err := os.ReadFile("../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 func getConfig() *bot.Configuration {
 	return &bot.Configuration{
 		ServerName: "irc.libera.chat",
@@ -38,8 +73,18 @@ func getConfig() *bot.Configuration {
 	}
 }
 
+// getState returns a state where users are in a channel with the bot,
+// identified to the account with the same name as their nick.
+func getState() *bot.State {
+	s := bot.NewState()
+	for _, nick := range []string{"me", "another"} {
+		s.Handle(getBot(), hbot.ParseMessage(fmt.Sprintf(":%s!u@example.org JOIN #somechannel %s :Real Name", nick, nick)))
+	}
+	return s
+}
+
 func getVerifyArgs(expected map[string]string, t *testing.T) CommandClosure {
-	return func(args map[string]string, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+	return func(args Args, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
 		for name, arg := range args {
 			if expected[name] != arg {
 				t.Errorf("%s != %s at args[%s]", expected[name], arg, name)
@@ -55,13 +100,14 @@ func testCommand(exp map[string]string, t *testing.T) *Command {
 		Action:        getVerifyArgs(exp, t),
 		Db:            getsql(),
 		Configuration: getConfig(),
+		State:         getState(),
 	}
 	c.InitParams()
 	return &c
 }
 
 func TestCommandArgs(t *testing.T) {
-	irc := &hbot.Bot{}
+	irc := getBot()
 	expected := map[string]string{"param": "what"}
 	c := testCommand(expected, t)
 	c.AddParameter("param", `\w+`).AllowPrivate()
@@ -76,7 +122,135 @@ func TestCommandNotAuthorized(t *testing.T) {
 	m.Name = "another"
 	// This will fail if the callback is ever called
 	// as we're comparing args to a nil map
-	c.Handle(&hbot.Bot{}, m)
+	c.Handle(getBot(), m)
+}
+
+func TestCommandAccounts(t *testing.T) {
+	called := false
+	c := testCommand(nil, t)
+	c.Action = func(args Args, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+		called = true
+		return true
+	}
+	c.AllowPrivate()
+	testCases := []struct {
+		nick    string
+		account string
+		allowed bool
+	}{
+		// Taking the nickname of an admin is not enough.
+		{"me", "someone", false},
+		{"me", "*", false},
+		// The account is what matters.
+		{"me_away", "me", true},
+	}
+	for _, tc := range testCases {
+		called = false
+		c.State.Handle(getBot(), hbot.ParseMessage(fmt.Sprintf(":%s!u@example.org JOIN #somechannel %s :Real Name", tc.nick, tc.account)))
+		m := forgeMsg("!test_command")
+		m.Name = tc.nick
+		c.Handle(getBot(), m)
+		if called != tc.allowed {
+			t.Errorf("%s identified as %s: expected allowed to be %v", tc.nick, tc.account, tc.allowed)
+		}
+	}
+}
+
+func TestCommandVisibility(t *testing.T) {
+	c := testCommand(nil, t)
+	c.AllowPrivate()
+	group := testCommand(nil, t)
+	group.ID = "contact"
+	group.AddSubcommand("get", group.Action).AllowChannel()
+	group.Action = nil
+	testCases := []struct {
+		account string
+		to      string
+		visible bool
+		group   bool
+	}{
+		{"me", "ircbot", true, false},
+		// Private commands are hidden in channels.
+		{"me", "#sre", false, true},
+		// Users not in the ACL don't see the command.
+		{"another", "ircbot", false, false},
+		{"", "#sre", false, false},
+	}
+	for _, tc := range testCases {
+		m := forgeMsg("!help")
+		m.To = tc.to
+		if c.visibleTo(tc.account, m) != tc.visible {
+			t.Errorf("%s in %s: expected the command to be visible: %v", tc.account, tc.to, tc.visible)
+		}
+		if group.visibleTo(tc.account, m) != tc.group {
+			t.Errorf("%s in %s: expected the group to be visible: %v", tc.account, tc.to, tc.group)
+		}
+	}
+	// Commands open to everyone skip the ACL.
+	c.AllowEveryone()
+	if !c.visibleTo("another", forgeMsg("!help")) {
+		t.Error("Commands allowed to everyone should be visible to everyone")
+	}
+	// Groups only list the subcommands the requester can run.
+	group.AddSubcommand("add", c.Action).AllowPrivate()
+	group.SetHelp("Manages contacts")
+	m := forgeMsg("!help")
+	m.To = "#sre"
+	visible := func(sub *Command) bool { return sub.visibleTo("me", m) }
+	if help := group.helpWithPrefix("!", visible); help != "Manages contacts. Subcommands: get" {
+		t.Errorf("Unexpected help message in #sre: %s", help)
+	}
+	if help := group.helpWithPrefix("!", nil); help != "Manages contacts. Subcommands: get, add" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestCommandDisabled(t *testing.T) {
+	db := getMemorySql(t)
+	called := false
+	group := testCommand(nil, t)
+	group.ID = "contact"
+	group.Db = db
+	group.AddSubcommand("get", func(args Args, irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, db *sql.DB) bool {
+		called = true
+		return true
+	}).AllowChannel().AllowPrivate()
+	group.Action = nil
+	if err := acl.DisableCommand("contact", "#public", db); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		to      string
+		enabled bool
+	}{
+		{"#public", false},
+		{"#sre", true},
+		{"ircbot", true},
+	}
+	for _, tc := range testCases {
+		called = false
+		m := forgeMsg("!contact get jane")
+		m.To = tc.to
+		group.Handle(getBot(), m)
+		if called != tc.enabled {
+			t.Errorf("%s: expected the command to run: %v", tc.to, tc.enabled)
+		}
+		if group.visibleTo("me", m) != tc.enabled {
+			t.Errorf("%s: expected the command to be visible: %v", tc.to, tc.enabled)
+		}
+	}
+	// Disabled commands are not suggested either.
+	r := NewRegistry()
+	if err := r.RegisterCommand(group); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range testCases {
+		m := forgeMsg("!contcat_get jane")
+		m.To = tc.to
+		if s := r.suggestions("contcat_get", "me", m); (len(s) > 0) != tc.enabled {
+			t.Errorf("%s: unexpected suggestions %v", tc.to, s)
+		}
+	}
 }
 
 func TestCommandDefault(t *testing.T) {
@@ -84,7 +258,7 @@ func TestCommandDefault(t *testing.T) {
 	c := testCommand(expected, t)
 	m := forgeMsg("!test_command")
 	c.AddParameterWithDefault("param", `\w+`, "what").AllowPrivate()
-	c.Handle(&hbot.Bot{}, m)
+	c.Handle(getBot(), m)
 }
 
 func TestCommandDefaultCb(t *testing.T) {
@@ -95,5 +269,397 @@ func TestCommandDefaultCb(t *testing.T) {
 	c := testCommand(expected, t)
 	m := forgeMsg("!test_command")
 	c.AddParameterWithDefaultCb("param", `\w+`, cb).AllowPrivate()
-	c.Handle(&hbot.Bot{}, m)
+	c.Handle(getBot(), m)
+}
+
+func TestCommandTrailing(t *testing.T) {
+	expected := map[string]string{"channel": "#sre", "topic": "Investigating  API latency in eqiad"}
+	c := testCommand(expected, t)
+	m := forgeMsg("!test_command #sre Investigating  API latency in eqiad ")
+	c.AddParameter("channel", `#\S+`).AddTrailingParameter("topic", `.+`).AllowPrivate()
+	if !c.Handle(getBot(), m) {
+		t.Error("The command was not executed")
+	}
+	if help := c.SetHelp("Sets the topic").Help(); help != "Sets the topic. Format: !test_command <channel> <topic...>" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestCommandQuoted(t *testing.T) {
+	expected := map[string]string{"name": "Jane Doe", "phone": "+3912345678", "email": "jane@example.org"}
+	c := testCommand(expected, t)
+	m := forgeMsg(`!test_command "Jane Doe" +3912345678 jane@example.org`)
+	c.AddParameter("name", `\w+`).AddParameter("phone", `\+\d+`).AddParameter("email", `\S+`).AllowPrivate()
+	if !c.Handle(getBot(), m) {
+		t.Error("The command was not executed")
+	}
+}
+
+func TestCommandEmptyMessage(t *testing.T) {
+	c := testCommand(nil, t)
+	c.AddParameter("param", `\w+`).AllowPrivate()
+	for _, content := range []string{"", "   ", `"!test_command`} {
+		if c.Handle(getBot(), forgeMsg(content)) {
+			t.Errorf("Content %q should not trigger the command", content)
+		}
+	}
+}
+
+func TestCommandTyped(t *testing.T) {
+	called := false
+	c := testCommand(nil, t)
+	c.Action = func(args Args, irc *hbot.Bot, m *hbot.Message, conf *bot.Configuration, db *sql.DB) bool {
+		called = true
+		if args.Int("count") != 3 || args.Duration("for") != 10*time.Minute || !args.Bool("force") {
+			t.Errorf("Wrong typed arguments: %v", args)
+		}
+		return true
+	}
+	c.AddIntParameter("count").AddDurationParameter("for").AddBoolParameter("force").AllowPrivate()
+	c.Handle(getBot(), forgeMsg("!test_command 3 10m yes"))
+	if !called {
+		t.Error("The command was not executed")
+	}
+	if help := c.SetHelp("Typed").Help(); help != "Typed. Format: !test_command <count:int> <for:duration> <force:yes|no>" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestSubcommands(t *testing.T) {
+	group := testCommand(nil, t)
+	group.Action = nil
+	called := ""
+	action := func(args Args, irc *hbot.Bot, m *hbot.Message, conf *bot.Configuration, db *sql.DB) bool {
+		called = args["name"]
+		return true
+	}
+	add := group.AddSubcommand("add", action).AddParameter("name", `\w+`).AllowPrivate()
+	group.AddSubcommand("get", action).AddParameter("name", `\w+`).AllowChannel()
+	if add.ID != "test_command_add" {
+		t.Errorf("Unexpected subcommand ID %s", add.ID)
+	}
+	for _, content := range []string{"!test_command add jane", "!test_command_add jane"} {
+		called = ""
+		if !group.Handle(getBot(), forgeMsg(content)) || called != "jane" {
+			t.Errorf("Subcommand not executed for %q", content)
+		}
+	}
+	// The get subcommand is only allowed in channels.
+	called = ""
+	group.Handle(getBot(), forgeMsg("!test_command get jane"))
+	if called != "" {
+		t.Error("A channel-only subcommand was executed in private")
+	}
+	if names := group.subcommandNames(forgeMsg("")); len(names) != 1 || names[0] != "add" {
+		t.Errorf("Unexpected subcommands available in private: %v", names)
+	}
+	if help := add.SetHelp("Adds").Help(); help != "Adds. Format: !test_command add <name>" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestRegistrySubcommandCollision(t *testing.T) {
+	r := NewRegistry()
+	group := testCommand(nil, t)
+	group.AddSubcommand("add", nil)
+	if err := r.RegisterCommand(group); err != nil {
+		t.Fatal(err)
+	}
+	flat := testCommand(nil, t)
+	flat.ID = "test_command_add"
+	if err := r.RegisterCommand(flat); err == nil {
+		t.Error("Registering a command with the same ID of a subcommand should fail")
+	}
+}
+
+func TestRegistryCommandIDs(t *testing.T) {
+	r := NewRegistry()
+	group := testCommand(nil, t)
+	group.Action = nil
+	group.AddSubcommand("remove", nil)
+	group.AddSubcommand("add", nil)
+	flat := testCommand(nil, t)
+	flat.ID = "another"
+	if err := r.RegisterCommands([]*Command{group, flat}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"another", "test_command_add", "test_command_remove"}
+	if ids := r.CommandIDs(); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected %v, got %v", expected, ids)
+	}
+}
+
+func TestCommandOptions(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected map[string]string
+	}{
+		{"!test_command what", map[string]string{"param": "what", "force": "false", "limit": "10", "note": "hello there"}},
+		{"!test_command --force what", map[string]string{"param": "what", "force": "true", "limit": "10", "note": "hello there"}},
+		{"!test_command what -f --limit=5", map[string]string{"param": "what", "force": "true", "limit": "5", "note": "hello there"}},
+		{"!test_command -l 5 what --  -f is not a flag", map[string]string{"param": "what", "force": "false", "limit": "5", "note": "-f is not a flag"}},
+		{"!test_command what --limit 7 don't stop", map[string]string{"param": "what", "force": "false", "limit": "7", "note": "don't stop"}},
+	}
+	for _, tc := range testCases {
+		c := testCommand(tc.expected, t)
+		c.AddParameter("param", `\w+`).AddTrailingParameter("note", ".*").AllowPrivate()
+		c.Parameter("note").Default("hello there")
+		c.AddFlag("force", "f").AddOption("limit", "l", `\d+`, "10")
+		if !c.Handle(getBot(), forgeMsg(tc.content)) {
+			t.Errorf("The command was not executed for %q", tc.content)
+		}
+	}
+	c := testCommand(nil, t)
+	c.AddParameter("param", `\w+`).AddFlag("force", "f").AddOption("limit", "", `\d+`, "10")
+	if _, err := c.parseMessage(forgeMsg("!test_command --nope what"), 1); err == nil {
+		t.Error("Unknown options should not be accepted")
+	}
+	if _, err := c.parseMessage(forgeMsg("!test_command what --limit"), 1); err == nil {
+		t.Error("Options without a value should not be accepted")
+	}
+	for _, content := range []string{"!test_command what --limit abc", "!test_command what --limit=5x"} {
+		_, err := c.parseMessage(forgeMsg(content), 1)
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) || usageErr.Parameter != "limit" {
+			t.Errorf("Expected a usage error about limit for %q, got %v", content, err)
+		}
+	}
+	// Durations that would make no sense are rejected, rather than ignored.
+	c.AddDurationOption("for", "")
+	for _, content := range []string{"!test_command what --for -1h", "!test_command what --for=0s"} {
+		if _, err := c.parseMessage(forgeMsg(content), 1); err == nil {
+			t.Errorf("Expected a usage error for %q", content)
+		}
+	}
+	if args, err := c.parseMessage(forgeMsg("!test_command what"), 1); err != nil || args.Duration("for") != 0 {
+		t.Errorf("Expected no duration when the option is not passed, got %v, %v", args, err)
+	}
+	if help := c.SetHelp("Opts").Help(); help != "Opts. Format: !test_command <param> [-f|--force] [--limit=<limit>] [--for=<for>]" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestCommandPrefix(t *testing.T) {
+	expected := map[string]string{"param": "what"}
+	c := testCommand(expected, t)
+	c.AddParameter("param", `\w+`).AllowPrivate().AllowChannel()
+	c.Configuration.CommandPrefix = "?"
+	c.Configuration.ChannelSettings = map[string]bot.ChannelSettings{"#sre": {CommandPrefix: "."}}
+	testCases := []struct {
+		content  string
+		to       string
+		executed bool
+	}{
+		{"?test_command what", "ircbot", true},
+		{"!test_command what", "ircbot", false},
+		{".test_command what", "#sre", true},
+		{"?test_command what", "#sre", false},
+		{"?test_command what", "#other", true},
+		{"IrcBot: test_command what", "#sre", true},
+		{"ircbot, .test_command what", "#sre", true},
+		{"IrcBot test_command what", "#sre", false},
+	}
+	for _, tc := range testCases {
+		m := forgeMsg(tc.content)
+		m.To = tc.to
+		if c.Handle(getBot(), m) != tc.executed {
+			t.Errorf("Unexpected result for %q in %s", tc.content, tc.to)
+		}
+	}
+	if help := c.SetHelp("Prefixed").Help(); help != "Prefixed. Format: ?test_command <param>" {
+		t.Errorf("Unexpected help message: %s", help)
+	}
+}
+
+func TestCommandAliases(t *testing.T) {
+	called := false
+	c := testCommand(nil, t)
+	c.Action = func(args Args, irc *hbot.Bot, m *hbot.Message, conf *bot.Configuration, db *sql.DB) bool {
+		called = true
+		return true
+	}
+	c.AddParameter("param", `\w+`).AddAlias("tc").AllowPrivate()
+	if !c.Handle(getBot(), forgeMsg("!tc what")) || !called {
+		t.Error("The command was not executed via its alias")
+	}
+	// ACLs are checked against the command ID, not the alias.
+	called = false
+	m := forgeMsg("!tc what")
+	m.Name = "another"
+	c.Handle(getBot(), m)
+	if called {
+		t.Error("The alias allowed bypassing the ACL")
+	}
+	r := NewRegistry()
+	if err := r.RegisterCommand(c); err != nil {
+		t.Fatal(err)
+	}
+	if r.Resolve("tc") != "test_command" {
+		t.Errorf("Alias resolved to %s", r.Resolve("tc"))
+	}
+	other := testCommand(nil, t)
+	other.ID = "tc"
+	if err := r.RegisterCommand(other); err == nil {
+		t.Error("Registering a command with the same ID of an alias should fail")
+	}
+	other.ID = "other"
+	other.AddAlias("test_command")
+	if err := r.RegisterCommand(other); err == nil {
+		t.Error("Registering an alias with the same name of a command should fail")
+	}
+}
+
+func TestSuggestions(t *testing.T) {
+	r := NewRegistry()
+	group := testCommand(nil, t)
+	group.ID = "contact"
+	group.AddSubcommand("get", group.Action).AllowPrivate()
+	group.AddSubcommand("add", group.Action).AllowPrivate()
+	group.Action = nil
+	public := testCommand(nil, t)
+	public.ID = "contacts_get"
+	public.AllowChannel()
+	r.RegisterCommands([]*Command{group, public})
+	if s := r.suggestions("contcat_get", "me", forgeMsg("")); len(s) == 0 || s[0] != "contact_get" {
+		t.Errorf("Unexpected suggestions in private: %v", s)
+	}
+	m := forgeMsg("")
+	m.To = "#sre"
+	// Private commands should not be suggested in a channel.
+	if s := r.suggestions("contcat_get", "me", m); len(s) != 1 || s[0] != "contacts_get" {
+		t.Errorf("Unexpected suggestions in a channel: %v", s)
+	}
+	// Nor should commands the sender can't run, as in the help.
+	if s := r.suggestions("contcat_get", "another", forgeMsg("")); len(s) != 0 {
+		t.Errorf("Unexpected suggestions for a user not in the ACL: %v", s)
+	}
+	if s := r.suggestions("xyzzy", "me", forgeMsg("")); len(s) != 0 {
+		t.Errorf("Unexpected suggestions for an unrelated word: %v", s)
+	}
+	conf := getConfig()
+	conf.ChannelSettings = map[string]bot.ChannelSettings{"#sre": {DisableSuggestions: true}}
+	m = forgeMsg("!contcat_get")
+	m.To = "#sre"
+	if r.suggest(getBot(), m, conf, getState()) {
+		t.Error("Suggestions should be disabled in #sre")
+	}
+	if !r.suggest(getBot(), forgeMsg("!contcat_get"), conf, getState()) {
+		t.Error("Suggestions should be given in private")
+	}
+	if r.suggest(getBot(), forgeMsg("!contact_get"), conf, getState()) {
+		t.Error("Suggestions should not be given for known commands")
+	}
+	if r.suggest(getBot(), forgeMsg("IrcBot: contcat_get"), conf, getState()) {
+		t.Error("Suggestions should only be given for lines starting with the prefix")
+	}
+}
+
+func TestCommandUsageError(t *testing.T) {
+	called := false
+	c := testCommand(nil, t)
+	c.Action = func(args Args, irc *hbot.Bot, m *hbot.Message, conf *bot.Configuration, db *sql.DB) bool {
+		called = true
+		return true
+	}
+	c.AddParameter("name", `^\w+$`).AddIntParameter("count").AllowPrivate()
+	testCases := []struct {
+		content   string
+		parameter string
+	}{
+		{"!test_command jane three", "count"},
+		{"!test_command jane", "count"},
+		{"!test_command ja-ne 3", "name"},
+		{"!test_command 'jane 3", ""},
+	}
+	for _, tc := range testCases {
+		_, err := c.parseMessage(forgeMsg(tc.content), 1)
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) {
+			t.Errorf("Expected a usage error for %q, got %v", tc.content, err)
+		} else if usageErr.Parameter != tc.parameter {
+			t.Errorf("Expected an error about %q for %q, got %q", tc.parameter, tc.content, usageErr.Parameter)
+		}
+		c.Handle(getBot(), forgeMsg(tc.content))
+		if called {
+			t.Errorf("The action was called despite the usage error for %q", tc.content)
+		}
+	}
+	if usage := c.usage("!"); usage != "!test_command <name> <count:int>" {
+		t.Errorf("Unexpected usage: %s", usage)
+	}
+}
+
+func TestCommandValidators(t *testing.T) {
+	c := testCommand(nil, t)
+	c.AddParameter("phone", `\+\d{5,15}`).AddParameterWithDefault("channel", `#\S+`, "#sre").AllowPrivate()
+	testCases := []struct {
+		content   string
+		parameter string
+	}{
+		// Values must match as a whole, not just contain a match.
+		{"!test_command call-me+123456x", "phone"},
+		{"!test_command +123456 notachannel", "channel"},
+	}
+	for _, tc := range testCases {
+		_, err := c.parseMessage(forgeMsg(tc.content), 1)
+		var usageErr *UsageError
+		if !errors.As(err, &usageErr) || usageErr.Parameter != tc.parameter {
+			t.Errorf("Expected an error about %q for %q, got %v", tc.parameter, tc.content, err)
+		}
+	}
+	// Parameters with a default can still be left out.
+	args, err := c.parseMessage(forgeMsg("!test_command +123456"), 1)
+	if err != nil || args["channel"] != "#sre" {
+		t.Errorf("Unexpected arguments %v, error %v", args, err)
+	}
+}
+
+func TestCommandManual(t *testing.T) {
+	c := testCommand(nil, t)
+	c.AddParameter("name", `\w+`).AddParameterWithDefault("count", `\d+`, "1").AddFlag("force", "f").AddAlias("tc")
+	c.Describe("name", "Who to greet", "jane").Describe("force", "Greet even if already greeted", "")
+	c.SetHelp("Greets someone").AddExample("test_command jane 3")
+	expected := []string{
+		"!test_command (aliases: tc) - Greets someone",
+		"Usage: !test_command <name> [<count>] [-f|--force]",
+		"Parameters:",
+		"    name                (required) Who to greet, e.g. jane",
+		"    count               (optional)",
+		"Options:",
+		"    -f, --force         (flag) Greet even if already greeted",
+		"Examples:",
+		"    !test_command jane 3",
+	}
+	manual := c.manual("!")
+	if len(manual) != len(expected) {
+		t.Fatalf("Unexpected manual: %q", manual)
+	}
+	for i, line := range manual {
+		if line != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], line)
+		}
+	}
+}
+
+func TestCommandList(t *testing.T) {
+	var values []string
+	c := testCommand(nil, t)
+	c.Action = func(args Args, irc *hbot.Bot, m *hbot.Message, conf *bot.Configuration, db *sql.DB) bool {
+		values = args.List("who")
+		return true
+	}
+	c.AddParameter("command", `\w+`).AddListParameter("who", `^[^-]+$`).AllowPrivate()
+	c.Handle(getBot(), forgeMsg(`!test_command contact_add alice "bob 'the' builder" #sre`))
+	if !reflect.DeepEqual(values, []string{"alice", "bob 'the' builder", "#sre"}) {
+		t.Errorf("Unexpected list values: %q", values)
+	}
+	if _, err := c.parseMessage(forgeMsg("!test_command contact_add alice b-b"), 1); err == nil {
+		t.Error("Each value in a list should be validated")
+	}
+	if _, err := c.parseMessage(forgeMsg("!test_command contact_add"), 1); err == nil {
+		t.Error("A list should have at least one value")
+	}
+	if usage := c.usage("!"); usage != "!test_command <command> <who>..." {
+		t.Errorf("Unexpected usage: %s", usage)
+	}
 }
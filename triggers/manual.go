@@ -0,0 +1,67 @@
+package triggers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// manual returns the full help of a command, one line at a time:
+// its usage, the description of all parameters and options, and
+// some example invocations.
+func (cmd Command) manual(prefix string) []string {
+	header := cmd.invocation(prefix)
+	if len(cmd.aliases) > 0 {
+		header = fmt.Sprintf("%s (aliases: %s)", header, strings.Join(cmd.aliases, ", "))
+	}
+	if cmd.HelpMsg != "" {
+		header = fmt.Sprintf("%s - %s", header, cmd.HelpMsg)
+	}
+	lines := []string{header, fmt.Sprintf("Usage: %s", cmd.usage(prefix))}
+	if len(cmd.paramOder) > 0 {
+		lines = append(lines, "Parameters:")
+		for _, name := range cmd.paramOder {
+			lines = append(lines, cmd.parameters[name].manualEntry(name))
+		}
+	}
+	if len(cmd.optionOrder) > 0 {
+		lines = append(lines, "Options:")
+		for _, name := range cmd.optionOrder {
+			c := cmd.options[name]
+			flags := "--" + name
+			if c.short != "" {
+				flags = fmt.Sprintf("-%s, --%s", c.short, name)
+			}
+			lines = append(lines, c.manualEntry(flags))
+		}
+	}
+	if len(cmd.examples) > 0 {
+		lines = append(lines, "Examples:")
+		for _, example := range cmd.examples {
+			lines = append(lines, fmt.Sprintf("    %s%s", prefix, example))
+		}
+	}
+	return lines
+}
+
+// manualEntry describes a parameter or an option in the manual of a command.
+func (c *CommandArgument) manualEntry(name string) string {
+	details := make([]string, 0)
+	if c.kind != "" {
+		details = append(details, c.kind)
+	}
+	if c.flag {
+		details = append(details, "flag")
+	} else if c.IsOptional() {
+		details = append(details, "optional")
+	} else {
+		details = append(details, "required")
+	}
+	entry := fmt.Sprintf("    %-20s(%s)", name, strings.Join(details, ", "))
+	if c.description != "" {
+		entry = fmt.Sprintf("%s %s", entry, c.description)
+	}
+	if c.example != "" {
+		entry = fmt.Sprintf("%s, e.g. %s", entry, c.example)
+	}
+	return entry
+}
@@ -0,0 +1,121 @@
+package triggers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+Named options.
+
+Besides positional parameters, a command can accept named options, which can
+be passed anywhere in the command line as --name=value, --name value or -n value,
+and flags, which are boolean options passed as --name or -n.
+A lone -- marks the end of the options: anything after it is a positional argument.
+*/
+
+var negativeNumber = regexp.MustCompile(`^-\d`)
+
+// isOption tells if a token looks like an option.
+// Negative numbers are considered positional arguments.
+func isOption(token string) bool {
+	return strings.HasPrefix(token, "-") && token != "-" && !negativeNumber.MatchString(token)
+}
+
+func (cmd *Command) addOption(name string, c *CommandArgument) {
+	if _, ok := cmd.options[name]; ok {
+		panic(fmt.Sprintf("Option %s declared twice", name))
+	}
+	cmd.options[name] = c
+	cmd.optionOrder = append(cmd.optionOrder, name)
+}
+
+// AddOption adds an option, with a validation regexp and a default value.
+// short is the one-letter form of the option, and can be empty.
+// The whole value passed must match the regexp.
+func (cmd *Command) AddOption(name string, short string, regex string, defaultValue string) *Command {
+	c := &CommandArgument{short: short}
+	c.SetValidator(anchored(regex))
+	c.Default(defaultValue)
+	cmd.addOption(name, c)
+	return cmd
+}
+
+// AddFlag adds a boolean option. The value of the flag will be "true"
+// if it was passed, "false" otherwise. Use Args.Bool to read it.
+func (cmd *Command) AddFlag(name string, short string) *Command {
+	c := &CommandArgument{short: short, flag: true, converter: toBool}
+	c.Default("false")
+	cmd.addOption(name, c)
+	return cmd
+}
+
+// AddDurationOption adds an option taking a positive duration, like 10m or 1h30m.
+// Use Args.Duration to read it: it's 0 if the option was not passed.
+func (cmd *Command) AddDurationOption(name string, short string) *Command {
+	c := &CommandArgument{short: short, kind: "duration", converter: toPositiveDuration}
+	cmd.addOption(name, c)
+	return cmd
+}
+
+// Option returns an option of the command, or nil if it doesn't exist.
+func (cmd *Command) Option(name string) *CommandArgument {
+	return cmd.options[name]
+}
+
+// findOption finds an option by its long or short form.
+func (cmd Command) findOption(token string) (string, *CommandArgument) {
+	if strings.HasPrefix(token, "--") {
+		name := strings.TrimPrefix(token, "--")
+		return name, cmd.options[name]
+	}
+	short := strings.TrimPrefix(token, "-")
+	for _, name := range cmd.optionOrder {
+		if c := cmd.options[name]; c.short != "" && c.short == short {
+			return name, c
+		}
+	}
+	return short, nil
+}
+
+// parseOption parses an option from the command line, consuming its value
+// from the tokenizer if needed, and stores its raw value.
+func (cmd Command) parseOption(token string, t *tokenizer, rawValues map[string]string) error {
+	optionName, value, hasValue := strings.Cut(token, "=")
+	name, c := cmd.findOption(optionName)
+	if c == nil {
+		return &UsageError{Reason: fmt.Sprintf("unknown option %s", optionName)}
+	}
+	if !hasValue {
+		if c.flag {
+			value = "true"
+		} else {
+			var ok bool
+			var err error
+			value, ok, err = t.next()
+			if err != nil {
+				return &UsageError{Reason: err.Error()}
+			}
+			if !ok {
+				return &UsageError{Parameter: optionName, Reason: "missing value"}
+			}
+		}
+	}
+	rawValues[name] = value
+	return nil
+}
+
+// optionHelp returns the representation of the option in the help message.
+func (c *CommandArgument) optionHelp(name string) string {
+	switch {
+	case c.flag && c.short != "":
+		return fmt.Sprintf("[-%s|--%s]", c.short, name)
+	case c.flag:
+		return fmt.Sprintf("[--%s]", name)
+	case c.short != "":
+		return fmt.Sprintf("[-%s|--%s=<%s>]", c.short, name, name)
+	default:
+		return fmt.Sprintf("[--%s=<%s>]", name, name)
+	}
+}
@@ -0,0 +1,247 @@
+package triggers
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Typed parameters.
+
+Typed parameters validate the value they receive and convert it to a
+canonical string representation, which is what the command action will
+find in its Args. The typed accessors of Args can then be used to get the
+converted value.
+*/
+type argsConverter func(string) (string, error)
+
+// now is used to compute relative times. It can be overridden in tests.
+var now = time.Now
+
+var nickRegexp = regexp.MustCompile("^[A-Za-z\\[\\]\\\\`_^{|}][A-Za-z0-9\\[\\]\\\\`_^{|}-]*$")
+var channelRegexp = regexp.MustCompile(`^[#&][^\s,\x07]+$`)
+
+// Formats accepted for absolute times, interpreted as UTC.
+var timeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func toInt(value string) (string, error) {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("expected an integer")
+	}
+	return strconv.Itoa(i), nil
+}
+
+func toFloat(value string) (string, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", fmt.Errorf("expected a number")
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+func toBool(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return "true", nil
+	case "false", "no", "off", "0":
+		return "false", nil
+	}
+	return "", fmt.Errorf("expected one of yes/no, true/false, on/off")
+}
+
+func toDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return "", fmt.Errorf("expected a duration like 30s, 10m or 2h")
+	}
+	return d.String(), nil
+}
+
+// toPositiveDuration only accepts durations longer than zero.
+func toPositiveDuration(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("expected a positive duration like 30s, 10m or 2h")
+	}
+	return d.String(), nil
+}
+
+// toTime accepts either an absolute time in one of the timeFormats,
+// "now", or a time relative to now like +2h or -30m.
+func toTime(value string) (string, error) {
+	var t time.Time
+	var err error
+	switch {
+	case value == "now":
+		t = now()
+	case strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-"):
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		t = now().Add(d)
+	default:
+		for _, format := range timeFormats {
+			t, err = time.ParseInLocation(format, value, time.UTC)
+			if err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("expected a time like 2022-07-01 15:04, now, or a relative time like +2h")
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+func toEnum(values []string) argsConverter {
+	return func(value string) (string, error) {
+		for _, allowed := range values {
+			if value == allowed {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of %s", strings.Join(values, ", "))
+	}
+}
+
+func toNick(value string) (string, error) {
+	if !nickRegexp.MatchString(value) {
+		return "", fmt.Errorf("expected an IRC nickname")
+	}
+	return value, nil
+}
+
+func toChannel(value string) (string, error) {
+	if !channelRegexp.MatchString(value) {
+		return "", fmt.Errorf("expected a channel name like #channel")
+	}
+	return value, nil
+}
+
+func toEmail(value string) (string, error) {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return "", fmt.Errorf("expected an email address")
+	}
+	return value, nil
+}
+
+func toURL(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("expected a full URL like https://example.org/")
+	}
+	return u.String(), nil
+}
+
+func (cmd *Command) addTypedParameter(name string, kind string, converter argsConverter) *Command {
+	c := &CommandArgument{kind: kind, converter: converter}
+	cmd.addParameter(name, c)
+	return cmd
+}
+
+// AddIntParameter adds an integer parameter. Use Args.Int to get its value.
+func (cmd *Command) AddIntParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "int", toInt)
+}
+
+// AddFloatParameter adds a numeric parameter. Use Args.Float to get its value.
+func (cmd *Command) AddFloatParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "number", toFloat)
+}
+
+// AddBoolParameter adds a boolean parameter, accepting yes/no, true/false and on/off.
+// Use Args.Bool to get its value.
+func (cmd *Command) AddBoolParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "yes|no", toBool)
+}
+
+// AddDurationParameter adds a duration parameter, like 10m or 1h30m.
+// Use Args.Duration to get its value.
+func (cmd *Command) AddDurationParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "duration", toDuration)
+}
+
+// AddTimeParameter adds a parameter accepting either an absolute time
+// or a time relative to now, like +2h. Use Args.Time to get its value.
+func (cmd *Command) AddTimeParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "time", toTime)
+}
+
+// AddEnumParameter adds a parameter that only accepts one of the given values.
+func (cmd *Command) AddEnumParameter(name string, values ...string) *Command {
+	return cmd.addTypedParameter(name, strings.Join(values, "|"), toEnum(values))
+}
+
+// AddNickParameter adds a parameter that must be a valid IRC nickname.
+func (cmd *Command) AddNickParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "nick", toNick)
+}
+
+// AddChannelParameter adds a parameter that must be a valid IRC channel name.
+func (cmd *Command) AddChannelParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "channel", toChannel)
+}
+
+// AddEmailParameter adds a parameter that must be an email address.
+func (cmd *Command) AddEmailParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "email", toEmail)
+}
+
+// AddURLParameter adds a parameter that must be a full URL.
+func (cmd *Command) AddURLParameter(name string) *Command {
+	return cmd.addTypedParameter(name, "url", toURL)
+}
+
+// Args holds the arguments of a command invocation, by parameter name.
+type Args map[string]string
+
+// String returns the value of a parameter as-is.
+func (a Args) String(name string) string {
+	return a[name]
+}
+
+// Int returns the value of an integer parameter, or 0 if it's not an integer.
+func (a Args) Int(name string) int {
+	i, _ := strconv.Atoi(a[name])
+	return i
+}
+
+// Float returns the value of a numeric parameter, or 0 if it's not a number.
+func (a Args) Float(name string) float64 {
+	f, _ := strconv.ParseFloat(a[name], 64)
+	return f
+}
+
+// Bool returns the value of a boolean parameter.
+func (a Args) Bool(name string) bool {
+	return a[name] == "true"
+}
+
+// Duration returns the value of a duration parameter, or 0 if it's not a duration.
+func (a Args) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(a[name])
+	return d
+}
+
+// Time returns the value of a time parameter, or the zero time if it's not a time.
+func (a Args) Time(name string) time.Time {
+	t, _ := time.Parse(time.RFC3339, a[name])
+	return t
+}
+
+// List returns the values of a list parameter.
+func (a Args) List(name string) []string {
+	values, _ := tokenize(a[name])
+	return values
+}
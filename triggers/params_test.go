@@ -0,0 +1,56 @@
+package triggers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConverters(t *testing.T) {
+	now = func() time.Time { return time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	testCases := []struct {
+		converter argsConverter
+		value     string
+		expected  string
+		err       bool
+	}{
+		{toInt, "42", "42", false},
+		{toInt, "-3", "-3", false},
+		{toInt, "4.2", "", true},
+		{toFloat, "4.20", "4.2", false},
+		{toFloat, "four", "", true},
+		{toBool, "Yes", "true", false},
+		{toBool, "off", "false", false},
+		{toBool, "maybe", "", true},
+		{toDuration, "90m", "1h30m0s", false},
+		{toDuration, "10", "", true},
+		{toPositiveDuration, "8h", "8h0m0s", false},
+		{toPositiveDuration, "-1h", "", true},
+		{toPositiveDuration, "0s", "", true},
+		{toTime, "2022-07-02 15:04", "2022-07-02T15:04:00Z", false},
+		{toTime, "2022-07-02", "2022-07-02T00:00:00Z", false},
+		{toTime, "+2h", "2022-07-01T12:00:00Z", false},
+		{toTime, "-30m", "2022-07-01T09:30:00Z", false},
+		{toTime, "now", "2022-07-01T10:00:00Z", false},
+		{toTime, "tomorrow", "", true},
+		{toEnum([]string{"on", "off"}), "on", "on", false},
+		{toEnum([]string{"on", "off"}), "maybe", "", true},
+		{toNick, "Jane_Doe[away]", "Jane_Doe[away]", false},
+		{toNick, "1jane", "", true},
+		{toChannel, "#sre", "#sre", false},
+		{toChannel, "sre", "", true},
+		{toEmail, "jane@example.org", "jane@example.org", false},
+		{toEmail, "Jane <jane@example.org>", "", true},
+		{toURL, "https://example.org/a?b=c", "https://example.org/a?b=c", false},
+		{toURL, "example.org", "", true},
+	}
+	for _, tc := range testCases {
+		value, err := tc.converter(tc.value)
+		if tc.err != (err != nil) {
+			t.Errorf("Unexpected error state converting %q: %v", tc.value, err)
+		}
+		if value != tc.expected {
+			t.Errorf("Converting %q: expected %q, got %q", tc.value, tc.expected, value)
+		}
+	}
+}
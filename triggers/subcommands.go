@@ -0,0 +1,109 @@
+package triggers
+
+import (
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+Subcommands.
+
+A command can have subcommands, so that related commands can be grouped
+under a common name, e.g. !contact add, !contact get.
+Each subcommand is a full-fledged command with its own parameters, help
+message and private/channel flags. Its ID is <command>_<name>, which is
+what ACLs refer to, and it can also be invoked directly as !<command>_<name>.
+*/
+
+// AddSubcommand adds a subcommand with the given name and action.
+// It returns the subcommand, so that it can be configured.
+func (cmd *Command) AddSubcommand(name string, action CommandClosure) *Command {
+	sub := &Command{
+		ID:            cmd.ID + "_" + name,
+		Action:        action,
+		Db:            cmd.Db,
+		Configuration: cmd.Configuration,
+		State:         cmd.State,
+		parent:        cmd,
+		name:          name,
+	}
+	sub.InitParams()
+	cmd.subcommands = append(cmd.subcommands, sub)
+	return sub
+}
+
+// Subcommands returns the subcommands of the command.
+func (cmd *Command) Subcommands() []*Command {
+	return cmd.subcommands
+}
+
+// isGroup returns true if the command is only a container for subcommands.
+func (cmd *Command) isGroup() bool {
+	return cmd.Action == nil && len(cmd.subcommands) > 0
+}
+
+// subcommandNames returns the names of the subcommands. If a message
+// is passed, only the subcommands that can be invoked where the message
+// was sent are returned.
+func (cmd *Command) subcommandNames(m *hbot.Message) []string {
+	names := make([]string, 0, len(cmd.subcommands))
+	for _, sub := range cmd.subcommands {
+		if m == nil || sub.allowedIn(m) {
+			names = append(names, sub.name)
+		}
+	}
+	return names
+}
+
+// invocation returns how the command is invoked, e.g. "!contact add".
+func (cmd *Command) invocation(prefix string) string {
+	if cmd.parent == nil {
+		return prefix + cmd.ID
+	}
+	return cmd.parent.invocation(prefix) + " " + cmd.name
+}
+
+// lookup finds the command or subcommand invoked by word, descending into
+// subcommands using the following words from the tokenizer as needed.
+// It returns the number of words that make up the invocation.
+func (cmd *Command) lookup(word string, t *tokenizer) (*Command, int) {
+	if !cmd.isCalled(word) {
+		for _, sub := range cmd.subcommands {
+			if target, words := sub.lookup(word, t); target != nil {
+				return target, words
+			}
+		}
+		return nil, 0
+	}
+	target, words := cmd, 1
+	for len(target.subcommands) > 0 {
+		pos := t.pos
+		name, ok, err := t.next()
+		if !ok || err != nil {
+			t.pos = pos
+			break
+		}
+		var found *Command
+		for _, sub := range target.subcommands {
+			if sub.name == name {
+				found = sub
+				break
+			}
+		}
+		if found == nil {
+			t.pos = pos
+			break
+		}
+		target = found
+		words++
+	}
+	return target, words
+}
+
+// all returns the command and all of its subcommands, recursively.
+func (cmd *Command) all() []*Command {
+	commands := []*Command{cmd}
+	for _, sub := range cmd.subcommands {
+		commands = append(commands, sub.all()...)
+	}
+	return commands
+}
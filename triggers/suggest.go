@@ -0,0 +1,128 @@
+package triggers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lavagetto/ircbot/bot"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+/*
+Suggestions for unknown commands.
+
+When a message looks like a command invocation, but no command with that
+name is registered, we reply with the names of the closest commands
+the sender can run where the message was sent.
+*/
+
+// How many suggestions to give, at most.
+const maxSuggestions = 3
+
+// Only words that look like a command name are considered, so that
+// we don't react to things like "!!!" or "!1".
+var commandWord = regexp.MustCompile(`^\w+$`)
+
+// editDistance computes the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+// suggestions returns the names of the commands closest to word that the
+// sender of the message, identified to account, can run where it was sent.
+func (r *Registry) suggestions(word string, account string, m *hbot.Message) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	maxDistance := len(word)/3 + 1
+	candidates := make([]candidate, 0)
+	for _, cmd := range r.commands {
+		if (cmd.Action == nil && !cmd.isGroup()) || !cmd.visibleTo(account, m) {
+			continue
+		}
+		for _, name := range append([]string{cmd.ID}, cmd.aliases...) {
+			d := editDistance(word, name)
+			if d <= maxDistance && d < len(word) {
+				candidates = append(candidates, candidate{name, d})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	names := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// suggest replies to the invocation of an unknown command with the
+// closest registered commands, if any. Like in the help, only the commands
+// the sender can run are suggested.
+func (r *Registry) suggest(irc *hbot.Bot, m *hbot.Message, c *bot.Configuration, state *bot.State) bool {
+	if m.Command != "PRIVMSG" {
+		return false
+	}
+	isChannel := strings.HasPrefix(m.To, "#")
+	if isChannel && !c.SuggestionsEnabled(m.To) {
+		return false
+	}
+	// Only lines starting with the command prefix are meant as commands for
+	// sure: anything else addressed to the bot could just be chatting with it.
+	prefix := prefixFor(m, c)
+	if !strings.HasPrefix(strings.TrimSpace(m.Content), prefix) {
+		return false
+	}
+	line, ok := commandLine(m, c)
+	if !ok {
+		return false
+	}
+	word, ok, err := newTokenizer(line).next()
+	if !ok || err != nil || !commandWord.MatchString(word) || r.isRegistered(word) {
+		return false
+	}
+	account, _ := state.Account(irc, m.Name)
+	names := r.suggestions(word, account, m)
+	if len(names) == 0 {
+		return false
+	}
+	for i, name := range names {
+		names[i] = prefix + name
+	}
+	irc.Reply(m, fmt.Sprintf("Unknown command %s%s. Did you mean %s?", prefix, word, strings.Join(names, " or ")))
+	return true
+}
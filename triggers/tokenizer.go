@@ -0,0 +1,126 @@
+package triggers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenizer splits a command line into arguments the way a shell would:
+// whitespace separates arguments, single and double quotes group words
+// together, and a backslash escapes the character that follows it.
+// Within single quotes every character is taken literally, while within
+// double quotes a backslash only escapes a double quote or another backslash.
+type tokenizer struct {
+	line string
+	pos  int
+}
+
+func newTokenizer(line string) *tokenizer {
+	return &tokenizer{line: line}
+}
+
+func (t *tokenizer) skipSpaces() {
+	for t.pos < len(t.line) {
+		r, size := utf8.DecodeRuneInString(t.line[t.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		t.pos += size
+	}
+}
+
+// next returns the next argument in the line. The boolean return value
+// is false once the line has been consumed.
+func (t *tokenizer) next() (string, bool, error) {
+	t.skipSpaces()
+	if t.pos >= len(t.line) {
+		return "", false, nil
+	}
+	var value strings.Builder
+	var quote rune
+	quoteStart := 0
+	for t.pos < len(t.line) {
+		r, size := utf8.DecodeRuneInString(t.line[t.pos:])
+		current := t.line[t.pos : t.pos+size]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				value.WriteString(current)
+			}
+		case r == '\\':
+			escapeStart := t.pos
+			t.pos += size
+			if t.pos >= len(t.line) {
+				return value.String(), true, fmt.Errorf("unfinished escape sequence at position %d", escapeStart+1)
+			}
+			escaped, escapedSize := utf8.DecodeRuneInString(t.line[t.pos:])
+			// Within double quotes, we only escape quotes and backslashes.
+			if quote == '"' && escaped != '"' && escaped != '\\' {
+				value.WriteString(current)
+				continue
+			}
+			value.WriteString(t.line[t.pos : t.pos+escapedSize])
+			t.pos += escapedSize
+			continue
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				value.WriteString(current)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			quoteStart = t.pos
+		case unicode.IsSpace(r):
+			return value.String(), true, nil
+		default:
+			value.WriteString(current)
+		}
+		t.pos += size
+	}
+	if quote != 0 {
+		return value.String(), true, fmt.Errorf("unbalanced %c quote at position %d", quote, quoteStart+1)
+	}
+	return value.String(), true, nil
+}
+
+// rest returns whatever is left of the line, verbatim.
+func (t *tokenizer) rest() string {
+	t.skipSpaces()
+	rest := strings.TrimRightFunc(t.line[t.pos:], unicode.IsSpace)
+	t.pos = len(t.line)
+	return rest
+}
+
+// tokenize splits a full line into its arguments.
+func tokenize(line string) ([]string, error) {
+	tokens := make([]string, 0)
+	t := newTokenizer(line)
+	for {
+		token, ok, err := t.next()
+		if err != nil {
+			return tokens, err
+		}
+		if !ok {
+			return tokens, nil
+		}
+		tokens = append(tokens, token)
+	}
+}
+
+// quote returns a representation of value that tokenize
+// will parse back as a single argument.
+func quote(value string) string {
+	if value != "" && strings.IndexFunc(value, needsQuoting) < 0 {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func needsQuoting(r rune) bool {
+	return unicode.IsSpace(r) || r == '\'' || r == '"' || r == '\\'
+}
@@ -0,0 +1,96 @@
+package triggers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected []string
+		err      bool
+	}{
+		{"", []string{}, false},
+		{"   ", []string{}, false},
+		{"!contact_get jane", []string{"!contact_get", "jane"}, false},
+		{`!contact_add "Jane Doe" +3912345678 jane@example.org`, []string{"!contact_add", "Jane Doe", "+3912345678", "jane@example.org"}, false},
+		{`!note 'single "quoted"'`, []string{"!note", `single "quoted"`}, false},
+		{`!note "double \"quoted\" \n"`, []string{"!note", `double "quoted" \n`}, false},
+		{`!note escaped\ space O\'Brien`, []string{"!note", "escaped space", "O'Brien"}, false},
+		{`!note 'con'cat"enated"`, []string{"!note", "concatenated"}, false},
+		{`!note "" ''`, []string{"!note", "", ""}, false},
+		{`!note "unbalanced`, []string{"!note"}, true},
+		{`!note O'Brien`, []string{"!note"}, true},
+		{`!note trailing\`, []string{"!note"}, true},
+	}
+	for _, tc := range testCases {
+		tokens, err := tokenize(tc.line)
+		if tc.err && err == nil {
+			t.Errorf("Expected an error tokenizing %q", tc.line)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("Unexpected error tokenizing %q: %s", tc.line, err)
+		}
+		if !reflect.DeepEqual(tokens, tc.expected) {
+			t.Errorf("Tokenizing %q: expected %q, got %q", tc.line, tc.expected, tokens)
+		}
+	}
+}
+
+func TestTokenizerRest(t *testing.T) {
+	tk := newTokenizer(`!topic_set   #sre  Don't "panic"  `)
+	tk.next()
+	tk.next()
+	if rest := tk.rest(); rest != `Don't "panic"` {
+		t.Errorf("Unexpected rest of line: %q", rest)
+	}
+	if _, ok, _ := tk.next(); ok {
+		t.Error("The tokenizer should be exhausted after calling rest()")
+	}
+}
+
+func FuzzTokenize(f *testing.F) {
+	f.Add(`!contact_add "Jane Doe" +3912345678 jane@example.org`)
+	f.Add(`!note 'it'\''s "fine"' \\ done`)
+	f.Add(`"unbalanced`)
+	f.Add("\\")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, line string) {
+		tokens, err := tokenize(line)
+		if err != nil {
+			return
+		}
+		// Quoting the tokens and joining them must give back the same tokens.
+		quoted := make([]string, len(tokens))
+		for i, token := range tokens {
+			quoted[i] = quote(token)
+		}
+		again, err := tokenize(strings.Join(quoted, " "))
+		if err != nil {
+			t.Fatalf("Error re-tokenizing %q: %s", quoted, err)
+		}
+		if !reflect.DeepEqual(tokens, again) {
+			t.Errorf("Round trip mismatch: %q != %q", tokens, again)
+		}
+	})
+}
+
+func FuzzTokenizerRest(f *testing.F) {
+	f.Add("!topic_set #sre Investigating API latency", 2)
+	f.Add("  !note  'a b'  c  ", 1)
+	f.Add("", 3)
+	f.Fuzz(func(t *testing.T, line string, skip int) {
+		tk := newTokenizer(line)
+		for i := 0; i < skip%8; i++ {
+			if _, _, err := tk.next(); err != nil {
+				return
+			}
+		}
+		rest := tk.rest()
+		if !strings.Contains(line, rest) {
+			t.Errorf("%q is not part of %q", rest, line)
+		}
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/lavagetto/ircbot/bot"
 
@@ -46,12 +47,18 @@ func (ev EvHandler) Help() string {
 type Registry struct {
 	// All the handlers, by ID
 	handlers map[string]HelpHandler
+	// All the commands and subcommands, by ID
+	commands map[string]*Command
+	// The IDs of commands, by alias
+	aliases map[string]string
 }
 
 // NewRegistry creates a new empty registry.
 func NewRegistry() *Registry {
 	var r Registry
 	r.handlers = make(map[string]HelpHandler)
+	r.commands = make(map[string]*Command)
+	r.aliases = make(map[string]string)
 	return &r
 }
 
@@ -59,7 +66,7 @@ func NewRegistry() *Registry {
 // a proper command, but rather a trigger.
 // For interactive commands, please use RegisterCommand below.
 func (r *Registry) Register(id string, handler TriggerFunc, help string, db *sql.DB, c *bot.Configuration) error {
-	if _, ok := r.handlers[id]; ok {
+	if r.isRegistered(id) {
 		msg := fmt.Sprintf("Cannot register handler with id '%s' twice", id)
 		return errors.New(msg)
 	}
@@ -74,17 +81,90 @@ func (r *Registry) Register(id string, handler TriggerFunc, help string, db *sql
 }
 
 // RegisterCommand allows to register a full-featured IRC command.
+// Subcommands are registered along with their parent command.
 func (r *Registry) RegisterCommand(command *Command) error {
-	id := command.ID
-	if _, ok := r.handlers[id]; ok {
-		msg := fmt.Sprintf("Cannot register handler with id '%s' twice", id)
-		return errors.New(msg)
+	commands := command.all()
+	// Check IDs and aliases against the ones already registered,
+	// and against each other.
+	names := make(map[string]bool)
+	for _, cmd := range commands {
+		for _, name := range append([]string{cmd.ID}, cmd.aliases...) {
+			if r.isRegistered(name) || names[name] {
+				msg := fmt.Sprintf("Cannot register handler with id '%s' twice", name)
+				return errors.New(msg)
+			}
+			names[name] = true
+		}
 	}
 	var h HelpHandler = *command
-	r.handlers[id] = h
+	r.handlers[command.ID] = h
+	for _, cmd := range commands {
+		r.commands[cmd.ID] = cmd
+		for _, alias := range cmd.aliases {
+			r.aliases[alias] = cmd.ID
+		}
+	}
 	return nil
 }
 
+func (r *Registry) isRegistered(id string) bool {
+	_, isHandler := r.handlers[id]
+	_, isCommand := r.commands[id]
+	_, isAlias := r.aliases[id]
+	return isHandler || isCommand || isAlias
+}
+
+// Resolve returns the ID of the command with the given name or alias.
+func (r *Registry) Resolve(name string) string {
+	if id, ok := r.aliases[name]; ok {
+		return id
+	}
+	return name
+}
+
+// IsCommand tells if a command, subcommand or group of subcommands
+// is registered with the given ID.
+func (r *Registry) IsCommand(id string) bool {
+	_, ok := r.commands[id]
+	return ok
+}
+
+// IsGroup tells if the command with the given ID is a group of subcommands.
+func (r *Registry) IsGroup(id string) bool {
+	cmd, ok := r.commands[id]
+	return ok && cmd.isGroup()
+}
+
+// Subcommands returns the names of the subcommands of a group.
+func (r *Registry) Subcommands(id string) []string {
+	cmd, ok := r.commands[id]
+	if !ok {
+		return []string{}
+	}
+	return cmd.subcommandNames(nil)
+}
+
+// CommandIDs returns the IDs of all the commands that can be invoked,
+// subcommands included, sorted.
+func (r *Registry) CommandIDs() []string {
+	ids := make([]string, 0, len(r.commands))
+	for id, cmd := range r.commands {
+		if !cmd.isGroup() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// displayName returns the ID of the command along with its aliases, if any.
+func (r *Registry) displayName(id string) string {
+	if cmd, ok := r.commands[id]; ok && len(cmd.aliases) > 0 {
+		return fmt.Sprintf("%s (%s)", id, strings.Join(cmd.aliases, ", "))
+	}
+	return id
+}
+
 func (r *Registry) RegisterCommands(commands []*Command) error {
 	for _, command := range commands {
 		err := r.RegisterCommand(command)
@@ -97,40 +177,107 @@ func (r *Registry) RegisterCommands(commands []*Command) error {
 
 // Deregister removes one handler from the system.
 func (r *Registry) Deregister(id string) {
+	if cmd, ok := r.commands[id]; ok && cmd.parent == nil {
+		for _, c := range cmd.all() {
+			delete(r.commands, c.ID)
+			for _, alias := range c.aliases {
+				delete(r.aliases, alias)
+			}
+		}
+	}
 	delete(r.handlers, id)
 }
 
 func (r *Registry) AddAll(b *bot.Bot, c *bot.Configuration) {
+	// Keep track of the accounts of users before anything else.
+	b.Irc.AddTrigger(b.State)
+	r.addState(b.State)
 	r.addHelp(b, c)
 	for id, Handler := range r.handlers {
 		log.Info("Registering handler", "id", id)
 		b.Irc.AddTrigger(Handler)
 	}
+	// Reply to unknown commands
+	b.Irc.AddTrigger(hbot.Trigger{
+		Condition: func(irc *hbot.Bot, m *hbot.Message) bool { return true },
+		Action: func(irc *hbot.Bot, m *hbot.Message) bool {
+			return r.suggest(irc, m, c, b.State)
+		},
+	})
+}
+
+// addState sets the state of the bot on the commands that don't have one yet.
+func (r *Registry) addState(state *bot.State) {
+	for _, cmd := range r.commands {
+		if cmd.State == nil {
+			cmd.State = state
+		}
+	}
+	// The registry holds a copy of top-level commands.
+	for id, handler := range r.handlers {
+		if cmd, ok := handler.(Command); ok {
+			r.handlers[id] = *r.commands[cmd.ID]
+		}
+	}
+}
+
+// helpFor returns the help message of an handler, rendered
+// with the given command prefix if it's a command, and only listing
+// the subcommands visible passes if it's a group.
+func helpFor(handler HelpHandler, prefix string, visible func(*Command) bool) string {
+	if cmd, ok := handler.(Command); ok {
+		return cmd.helpWithPrefix(prefix, visible)
+	}
+	return handler.Help()
 }
 
 // Help prints out the help for the registered commands
 func (r *Registry) addHelp(b *bot.Bot, c *bot.Configuration) {
 	defaultCommand := "~"
-	helpAction := func(args map[string]string,
+	helpAction := func(args Args,
 		bot *hbot.Bot,
 		m *hbot.Message,
 		c *bot.Configuration,
 		db *sql.DB,
 	) bool {
-		command := args["command"]
+		// Render the help with the command prefix in use where we were asked.
+		channel := ""
+		if strings.HasPrefix(m.To, "#") {
+			channel = m.To
+		}
+		prefix := c.PrefixFor(channel)
+		// Only show the commands the requester can run here, unless
+		// an admin asks for all of them.
+		account, _ := b.State.Account(bot, m.Name)
+		all := args.Bool("all")
+		if all && !c.IsAdmin(account) {
+			bot.Reply(m, "Only admins can see the help for all commands.")
+			return true
+		}
+		visible := func(cmd *Command) bool {
+			return all || cmd.visibleTo(account, m)
+		}
+		command := r.Resolve(strings.TrimPrefix(args["command"], prefix))
+		// Subcommands can be asked for as "contact add" or "contact_add".
+		if subcommand := args["subcommand"]; subcommand != defaultCommand {
+			command = command + "_" + subcommand
+		}
 		// No command provided, the full help will be printed out.
 		if command == defaultCommand {
 			bot.Reply(m, fmt.Sprintf("%s - irc bot for handling outages", c.NickName))
 			bot.Reply(m, "")
 			bot.Reply(m, "Available commands:")
-			bot.Reply(m, fmt.Sprintf("%-16s%s\n", "!help", "Prints this message"))
+			bot.Reply(m, fmt.Sprintf("%-16s%s\n", prefix+r.displayName("help"), "Prints this message"))
 			var handlers_help = make([]string, 0, len(r.handlers))
 			// get the help messages for all handlers that have one.
 			for name, handler := range r.handlers {
-				help_msg := handler.Help()
+				if cmd, ok := handler.(Command); ok && !visible(&cmd) {
+					continue
+				}
+				help_msg := helpFor(handler, prefix, visible)
 				// Some commands might not have an help message by design...
 				if help_msg != "" {
-					handlers_help = append(handlers_help, fmt.Sprintf("%-16s%s\n", name, help_msg))
+					handlers_help = append(handlers_help, fmt.Sprintf("%-16s%s\n", r.displayName(name), help_msg))
 				}
 			}
 			// We want a sorted output
@@ -139,7 +286,27 @@ func (r *Registry) addHelp(b *bot.Bot, c *bot.Configuration) {
 				bot.Reply(m, msg)
 			}
 		} else {
-			if cmd, ok := r.handlers[command]; ok {
+			cmd, ok := r.commands[command]
+			if ok && !visible(cmd) {
+				// Don't tell apart commands that don't exist from the ones
+				// the requester can't run.
+				bot.Reply(m, fmt.Sprintf("Sorry, I have no help for command '%s'.", command))
+			} else if ok && !cmd.isGroup() {
+				for _, line := range cmd.manual(prefix) {
+					bot.Reply(m, line)
+				}
+			} else if ok {
+				bot.Reply(m, fmt.Sprintf("Help for command %s:", command))
+				bot.Reply(m, fmt.Sprintf("%-16s%s\n", r.displayName(command), cmd.helpWithPrefix(prefix, visible)))
+				for _, sub := range cmd.subcommands {
+					if !visible(sub) {
+						continue
+					}
+					if help := sub.helpWithPrefix(prefix, visible); help != "" {
+						bot.Reply(m, fmt.Sprintf("%-16s%s\n", r.displayName(sub.ID), help))
+					}
+				}
+			} else if cmd, ok := r.handlers[command]; ok {
 				bot.Reply(m, fmt.Sprintf("Help for command %s:", command))
 				bot.Reply(m, fmt.Sprintf("%-16s%s\n", command, cmd.Help()))
 			} else {
@@ -153,9 +320,20 @@ func (r *Registry) addHelp(b *bot.Bot, c *bot.Configuration) {
 		Action:        helpAction,
 		Db:            b.DB,
 		Configuration: c,
+		State:         b.State,
 	}
 	help.InitParams()
-	help.AddParameterWithDefault("command", `\S+`, defaultCommand).AllowChannel().AllowPrivate()
+	help.AddParameterWithDefault("command", `\S+`, defaultCommand).AddParameterWithDefault("subcommand", `\S+`, defaultCommand)
+	help.Describe("command", "The command to get help for", "acl").Describe("subcommand", "The subcommand to get help for", "get")
+	help.AddFlag("all", "a").Describe("all", "Show all commands, even the ones you can't run here (admins only)", "")
+	help.AddExample("help acl get")
+	help.AddExample("help --all")
+	// Everyone can ask for help: the output only shows what they can run.
+	help.AllowChannel().AllowPrivate().AllowEveryone()
+	// Don't take the short alias away from another command.
+	if !r.isRegistered("h") {
+		help.AddAlias("h")
+	}
 	// now add it to the registry
 	if err := r.RegisterCommand(help); err != nil {
 		log.Error("Error registering the help handler", "error", err)